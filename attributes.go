@@ -0,0 +1,95 @@
+package zephyr
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+const (
+	AttributeEventName = "eventName"
+	AttributeEventID   = "eventID"
+	AttributeTableName = "tableName"
+	AttributeEnv       = "env"
+
+	// AttributeContentType is set on messages published with a MessageEncoder or
+	// WithCloudEvents; the latter are always CloudEventsContentType.  Encoded bodies that
+	// were claim checked are published without it; the ClaimCheck carries the type instead.
+	AttributeContentType = "contentType"
+)
+
+// StringAttribute returns an SNS message attribute of type String
+func StringAttribute(v string) *sns.MessageAttributeValue {
+	return &sns.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(v),
+	}
+}
+
+// TableName returns the table name from the stream's EventSourceARN,
+// arn:aws:dynamodb:region:account:table/<name>/stream/<label>
+func TableName(record Record) (string, bool) {
+	segments := strings.Split(record.EventSourceARN, "/")
+	if len(segments) < 2 || segments[1] == "" {
+		return "", false
+	}
+	return segments[1], true
+}
+
+// defaultAttributes returns the attributes every message carries
+func defaultAttributes(record Record, env string) map[string]*sns.MessageAttributeValue {
+	attributes := map[string]*sns.MessageAttributeValue{}
+
+	if record.EventName != "" {
+		attributes[AttributeEventName] = StringAttribute(record.EventName)
+	}
+	if record.EventID != "" {
+		attributes[AttributeEventID] = StringAttribute(record.EventID)
+	}
+	if tableName, ok := TableName(record); ok {
+		attributes[AttributeTableName] = StringAttribute(tableName)
+	}
+	if env != "" {
+		attributes[AttributeEnv] = StringAttribute(env)
+	}
+
+	return attributes
+}
+
+func (h *Handler) messageAttributes(record Record, env string) (map[string]*sns.MessageAttributeValue, error) {
+	attributes := defaultAttributes(record, env)
+	if h.cloudEvents != nil {
+		attributes[AttributeContentType] = StringAttribute(CloudEventsContentType)
+	}
+
+	if h.attributer == nil {
+		return attributes, nil
+	}
+
+	custom, err := h.attributer.MessageAttributes(record)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range custom {
+		attributes[k] = v
+	}
+
+	return attributes, nil
+}
+
+// withContentType returns a copy of attributes with AttributeContentType set, unless a
+// MessageAttributer already set it
+func withContentType(attributes map[string]*sns.MessageAttributeValue, contentType string) map[string]*sns.MessageAttributeValue {
+	if _, ok := attributes[AttributeContentType]; ok {
+		return attributes
+	}
+
+	copied := make(map[string]*sns.MessageAttributeValue, len(attributes)+1)
+	for k, v := range attributes {
+		copied[k] = v
+	}
+	copied[AttributeContentType] = StringAttribute(contentType)
+	return copied
+}
@@ -0,0 +1,215 @@
+package zephyr
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// AvroContentType identifies messages encoded by AvroEncoder
+const AvroContentType = "application/vnd.apache.avro+binary; schema=zephyr.Record"
+
+// AvroRecordSchema is the Avro schema, in parsing canonical form, that AvroEncoder
+// encodes records with.  It mirrors zephyr.Record field for field; each
+// AttributeValue is a record whose one non-null field holds the value.
+const AvroRecordSchema = `{"name":"zephyr.Record","type":"record","fields":[` +
+	`{"name":"awsRegion","type":"string"},` +
+	`{"name":"dynamodb","type":{"name":"zephyr.StreamRecord","type":"record","fields":[` +
+	`{"name":"ApproximateCreationDateTime","type":"double"},` +
+	`{"name":"Keys","type":{"type":"map","values":{"name":"zephyr.AttributeValue","type":"record","fields":[` +
+	`{"name":"B","type":["null","bytes"]},` +
+	`{"name":"BOOL","type":["null","boolean"]},` +
+	`{"name":"BS","type":["null",{"type":"array","items":"bytes"}]},` +
+	`{"name":"L","type":["null",{"type":"array","items":"zephyr.AttributeValue"}]},` +
+	`{"name":"M","type":["null",{"type":"map","values":"zephyr.AttributeValue"}]},` +
+	`{"name":"N","type":["null","string"]},` +
+	`{"name":"NS","type":["null",{"type":"array","items":"string"}]},` +
+	`{"name":"NULL","type":["null","boolean"]},` +
+	`{"name":"S","type":["null","string"]},` +
+	`{"name":"SS","type":["null",{"type":"array","items":"string"}]}]}}},` +
+	`{"name":"NewImage","type":{"type":"map","values":"zephyr.AttributeValue"}},` +
+	`{"name":"OldImage","type":{"type":"map","values":"zephyr.AttributeValue"}},` +
+	`{"name":"SequenceNumber","type":"string"},` +
+	`{"name":"SizeBytes","type":"long"},` +
+	`{"name":"StreamViewType","type":"string"}]}},` +
+	`{"name":"eventID","type":"string"},` +
+	`{"name":"eventName","type":"string"},` +
+	`{"name":"eventSource","type":"string"},` +
+	`{"name":"eventSourceARN","type":"string"},` +
+	`{"name":"eventVersion","type":"string"}]}`
+
+// AvroEncoder encodes records with AvroRecordSchema using Avro's single object
+// encoding; each message starts with the schema's CRC-64-AVRO fingerprint so consumers
+// can resolve the schema from their registry.
+type AvroEncoder struct{}
+
+// AvroSchemaFingerprint is the CRC-64-AVRO fingerprint of AvroRecordSchema
+var AvroSchemaFingerprint = avroFingerprint([]byte(AvroRecordSchema))
+
+func (AvroEncoder) ContentType() string {
+	return AvroContentType
+}
+
+func (AvroEncoder) EncodeRecord(record Record) ([]byte, error) {
+	b := avroBuffer{0xC3, 0x01}
+	b = append(b, make([]byte, 8)...)
+	binary.LittleEndian.PutUint64(b[2:], AvroSchemaFingerprint)
+
+	b.string(record.AwsRegion)
+	b.double(record.Dynamodb.ApproximateCreationDateTime)
+	b.attributeMap(record.Dynamodb.Keys)
+	b.attributeMap(record.Dynamodb.NewImage)
+	b.attributeMap(record.Dynamodb.OldImage)
+	b.string(record.Dynamodb.SequenceNumber)
+	b.long(record.Dynamodb.SizeBytes)
+	b.string(record.Dynamodb.StreamViewType)
+	b.string(record.EventID)
+	b.string(record.EventName)
+	b.string(record.EventSource)
+	b.string(record.EventSourceARN)
+	b.string(record.EventVersion)
+
+	return b, nil
+}
+
+// avroBuffer appends values in the Avro binary encoding
+type avroBuffer []byte
+
+func (b *avroBuffer) long(v int64) {
+	u := uint64(v<<1) ^ uint64(v>>63)
+	for u >= 0x80 {
+		*b = append(*b, byte(u)|0x80)
+		u >>= 7
+	}
+	*b = append(*b, byte(u))
+}
+
+func (b *avroBuffer) bytes(v []byte) {
+	b.long(int64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *avroBuffer) string(v string) {
+	b.bytes([]byte(v))
+}
+
+func (b *avroBuffer) boolean(v bool) {
+	if v {
+		*b = append(*b, 1)
+	} else {
+		*b = append(*b, 0)
+	}
+}
+
+func (b *avroBuffer) double(v float64) {
+	*b = append(*b, make([]byte, 8)...)
+	binary.LittleEndian.PutUint64((*b)[len(*b)-8:], math.Float64bits(v))
+}
+
+// null writes the null branch of a ["null", T] union and reports whether v is null;
+// otherwise it selects the T branch
+func (b *avroBuffer) null(isNull bool) bool {
+	if isNull {
+		b.long(0)
+	} else {
+		b.long(1)
+	}
+	return isNull
+}
+
+func (b *avroBuffer) strings(values []*string) {
+	if len(values) > 0 {
+		b.long(int64(len(values)))
+		for _, v := range values {
+			if v == nil {
+				b.string("")
+			} else {
+				b.string(*v)
+			}
+		}
+	}
+	b.long(0)
+}
+
+func (b *avroBuffer) attributeMap(item map[string]AttributeValue) {
+	if len(item) > 0 {
+		keys := make([]string, 0, len(item))
+		for k := range item {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.long(int64(len(keys)))
+		for _, k := range keys {
+			b.string(k)
+			b.attributeValue(item[k])
+		}
+	}
+	b.long(0)
+}
+
+func (b *avroBuffer) attributeValue(av AttributeValue) {
+	if !b.null(av.B == nil) {
+		b.bytes(av.B)
+	}
+	if !b.null(av.BOOL == nil) {
+		b.boolean(*av.BOOL)
+	}
+	if !b.null(av.BS == nil) {
+		if len(av.BS) > 0 {
+			b.long(int64(len(av.BS)))
+			for _, v := range av.BS {
+				b.bytes(v)
+			}
+		}
+		b.long(0)
+	}
+	if !b.null(av.L == nil) {
+		if len(av.L) > 0 {
+			b.long(int64(len(av.L)))
+			for _, item := range av.L {
+				b.attributeValue(item)
+			}
+		}
+		b.long(0)
+	}
+	if !b.null(av.M == nil) {
+		b.attributeMap(av.M)
+	}
+	if !b.null(av.N == nil) {
+		b.string(*av.N)
+	}
+	if !b.null(av.NS == nil) {
+		b.strings(av.NS)
+	}
+	if !b.null(av.NULL == nil) {
+		b.boolean(*av.NULL)
+	}
+	if !b.null(av.S == nil) {
+		b.string(*av.S)
+	}
+	if !b.null(av.SS == nil) {
+		b.strings(av.SS)
+	}
+}
+
+// avroFingerprint computes the CRC-64-AVRO (Rabin) fingerprint defined by the Avro
+// specification
+func avroFingerprint(data []byte) uint64 {
+	const empty = 0xc15d213aa4d7a795
+
+	var table [256]uint64
+	for i := range table {
+		fp := uint64(i)
+		for j := 0; j < 8; j++ {
+			fp = (fp >> 1) ^ (empty & -(fp & 1))
+		}
+		table[i] = fp
+	}
+
+	fp := uint64(empty)
+	for _, c := range data {
+		fp = (fp >> 8) ^ table[byte(fp)^c]
+	}
+	return fp
+}
@@ -1,37 +1,188 @@
 package zephyr
 
-import "sync"
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// CacheOptions configures the topic arn cache
+type CacheOptions struct {
+	// TTL is how long a topic arn is cached; 0 caches arns for the life of the process
+	TTL time.Duration
+
+	// MaxEntries bounds the cache, evicting the least recently used arn; 0 is unbounded
+	MaxEntries int
+
+	// NegativeTTL is how long a failed lookup is remembered; 0 disables negative caching.
+	// Retryable errors, such as throttling, TopicGuard denials and lookups cut short by the
+	// invocation's context are never cached.
+	NegativeTTL time.Duration
+}
+
+// CacheStats counts cache lookups
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// call is an in-flight topic arn lookup shared by concurrent callers
+type call struct {
+	wg  *sync.WaitGroup
+	arn *string
+	err error
+}
+
+type entry struct {
+	topicName string
+	arn       *string
+	err       error
+	expires   time.Time // zero for no expiry
+}
 
 type cache struct {
-	data map[string]*string
-	mux  *sync.Mutex
+	opts     CacheOptions
+	data     map[string]*list.Element
+	lru      *list.List
+	inflight map[string]*call
+	mux      *sync.Mutex
+	now      func() time.Time
+	hits     int64
+	misses   int64
+}
+
+// get returns the unexpired entry for topicName; the caller must hold mux
+func (c *cache) get(topicName string) (*entry, bool) {
+	elem, ok := c.data[topicName]
+	if !ok {
+		return nil, false
+	}
+
+	e := elem.Value.(*entry)
+	if !e.expires.IsZero() && !c.now().Before(e.expires) {
+		c.lru.Remove(elem)
+		delete(c.data, topicName)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return e, true
+}
+
+// set stores an entry for topicName; the caller must hold mux
+func (c *cache) set(topicName string, arn *string, err error, ttl time.Duration) {
+	e := &entry{
+		topicName: topicName,
+		arn:       arn,
+		err:       err,
+	}
+	if ttl > 0 {
+		e.expires = c.now().Add(ttl)
+	}
+
+	if elem, ok := c.data[topicName]; ok {
+		elem.Value = e
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.data[topicName] = c.lru.PushFront(e)
+
+	if c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.data, oldest.Value.(*entry).topicName)
+	}
 }
 
 func (c *cache) Get(topicName string) (*string, bool) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
-	arn, ok := c.data[topicName]
-	return arn, ok
+	e, ok := c.get(topicName)
+	if !ok || e.err != nil {
+		return nil, false
+	}
+	return e.arn, true
 }
 
 func (c *cache) Set(topicName string, topicArn *string) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
-	c.data[topicName] = topicArn
+	c.set(topicName, topicArn, nil, c.opts.TTL)
 }
 
 func (c *cache) Delete(topicName string) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
-	delete(c.data, topicName)
+	if elem, ok := c.data[topicName]; ok {
+		c.lru.Remove(elem)
+		delete(c.data, topicName)
+	}
+}
+
+// GetOrLoad returns the cached arn for topicName, calling load on a miss.  Concurrent
+// misses for the same topicName share a single call to load.  loaded reports whether
+// this caller performed the lookup.  Failures caused by ctx ending belong to this
+// invocation, not the topic, so they are never negatively cached.
+func (c *cache) GetOrLoad(ctx context.Context, topicName string, load func(string) (*string, error)) (topicArn *string, loaded bool, err error) {
+	c.mux.Lock()
+	if e, ok := c.get(topicName); ok {
+		c.mux.Unlock()
+		atomic.AddInt64(&c.hits, 1)
+		return e.arn, false, e.err
+	}
+	atomic.AddInt64(&c.misses, 1)
+	if v, ok := c.inflight[topicName]; ok {
+		c.mux.Unlock()
+		v.wg.Wait()
+		return v.arn, false, v.err
+	}
+
+	v := &call{wg: &sync.WaitGroup{}}
+	v.wg.Add(1)
+	c.inflight[topicName] = v
+	c.mux.Unlock()
+
+	v.arn, v.err = load(topicName)
+
+	c.mux.Lock()
+	if v.err == nil {
+		c.set(topicName, v.arn, nil, c.opts.TTL)
+	} else if c.opts.NegativeTTL > 0 && !IsRetryable(v.err) && v.err != ErrTopicDenied && !isContextErr(v.err) && ctx.Err() == nil {
+		c.set(topicName, nil, v.err, c.opts.NegativeTTL)
+	}
+	delete(c.inflight, topicName)
+	c.mux.Unlock()
+	v.wg.Done()
+
+	return v.arn, true, v.err
 }
 
-func newCache() *cache {
+func (c *cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadInt64(&c.hits),
+		Misses: atomic.LoadInt64(&c.misses),
+	}
+}
+
+func newCache(opts CacheOptions) *cache {
 	return &cache{
-		data: map[string]*string{},
-		mux:  &sync.Mutex{},
+		opts:     opts,
+		data:     map[string]*list.Element{},
+		lru:      list.New(),
+		inflight: map[string]*call{},
+		mux:      &sync.Mutex{},
+		now:      time.Now,
 	}
 }
+
+// isContextErr reports whether err is the error of a cancelled or expired context
+func isContextErr(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
@@ -1,12 +1,20 @@
 package zephyr
 
-import "testing"
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
 
 func TestCache(t *testing.T) {
 	topicName := "hello"
 	topicArn := "hello:arn"
 
-	c := newCache()
+	c := newCache(CacheOptions{})
 
 	_, ok := c.Get(topicName)
 	if ok {
@@ -34,3 +42,129 @@ func TestCache(t *testing.T) {
 		t.Errorf("expected false; got true")
 	}
 }
+
+func TestCacheGetOrLoadConcurrent(t *testing.T) {
+	topicArn := "hello:arn"
+	c := newCache(CacheOptions{})
+
+	var loads int32
+	load := func(topicName string) (*string, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(10 * time.Millisecond)
+		return &topicArn, nil
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _, err := c.GetOrLoad(context.Background(), "hello", load)
+			if err != nil || *v != topicArn {
+				t.Errorf("expected %v; got %v, %v", topicArn, v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("expected 1 load; got %v", loads)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	topicArn := "hello:arn"
+	now := time.Now()
+
+	c := newCache(CacheOptions{TTL: time.Minute})
+	c.now = func() time.Time { return now }
+
+	c.Set("hello", &topicArn)
+	if _, ok := c.Get("hello"); !ok {
+		t.Errorf("expected true; got false")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("hello"); ok {
+		t.Errorf("expected expired entry; got true")
+	}
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	topicArn := "arn"
+	c := newCache(CacheOptions{MaxEntries: 2})
+
+	c.Set("a", &topicArn)
+	c.Set("b", &topicArn)
+	c.Get("a") // b is now least recently used
+	c.Set("c", &topicArn)
+
+	for name, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := c.Get(name); ok != expected {
+			t.Errorf("%v: expected %v; got %v", name, expected, ok)
+		}
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	now := time.Now()
+	boom := errors.New("boom")
+
+	c := newCache(CacheOptions{NegativeTTL: time.Second})
+	c.now = func() time.Time { return now }
+
+	var loads int
+	load := func(topicName string) (*string, error) {
+		loads++
+		return nil, boom
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := c.GetOrLoad(context.Background(), "hello", load); err != boom {
+			t.Errorf("expected boom; got %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("expected 1 load; got %v", loads)
+	}
+
+	now = now.Add(time.Second)
+	c.GetOrLoad(context.Background(), "hello", load)
+	if loads != 2 {
+		t.Errorf("expected 2 loads; got %v", loads)
+	}
+
+	if stats := c.Stats(); stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("expected 2 hits and 2 misses; got %#v", stats)
+	}
+}
+
+func TestCacheNegativeIgnoresContextErrors(t *testing.T) {
+	c := newCache(CacheOptions{NegativeTTL: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	testCases := map[string]struct {
+		Ctx context.Context
+		Err error
+	}{
+		"canceled":          {Ctx: context.Background(), Err: context.Canceled},
+		"deadline exceeded": {Ctx: context.Background(), Err: context.DeadlineExceeded},
+		"ctx done":          {Ctx: ctx, Err: errors.New("request aborted")},
+	}
+
+	for label, tc := range testCases {
+		var loads int
+		load := func(topicName string) (*string, error) {
+			loads++
+			return nil, tc.Err
+		}
+
+		c.GetOrLoad(tc.Ctx, label, load)
+		c.GetOrLoad(context.Background(), label, load)
+		if loads != 2 {
+			t.Errorf("%v: expected 2 loads; got %v", label, loads)
+		}
+	}
+}
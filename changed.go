@@ -0,0 +1,91 @@
+package zephyr
+
+// ChangedTopicNamer decorates a TopicNamer so records are only routed when one of
+// Paths differs between the OldImage and NewImage.  Paths use the syntax
+// LookupAttribute accepts; a path also matches changes nested beneath it, so address
+// matches address.city and lines.0 matches lines[0].qty.  Changes beneath Ignore are disregarded, which keeps housekeeping
+// attributes such as updatedAt or version from producing events on their own.  An
+// empty Paths matches any change that isn't ignored.
+//
+// Records that don't match return an empty topic name and are skipped.  The table's
+// stream must use the NEW_AND_OLD_IMAGES view type.
+type ChangedTopicNamer struct {
+	Namer  TopicNamer
+	Paths  []string
+	Ignore []string
+}
+
+// WhenChanged routes records with namer only when one of paths has changed
+func WhenChanged(namer TopicNamer, paths ...string) *ChangedTopicNamer {
+	return &ChangedTopicNamer{
+		Namer: namer,
+		Paths: paths,
+	}
+}
+
+// Ignoring adds paths whose changes should be disregarded
+func (c *ChangedTopicNamer) Ignoring(paths ...string) *ChangedTopicNamer {
+	c.Ignore = append(c.Ignore, paths...)
+	return c
+}
+
+func (c *ChangedTopicNamer) TopicName(record Record) (string, error) {
+	if !c.Changed(record) {
+		return "", nil
+	}
+	return c.Namer.TopicName(record)
+}
+
+// Changed reports whether record changes any of the watched paths
+func (c *ChangedTopicNamer) Changed(record Record) bool {
+	for _, change := range Diff(record.Dynamodb.OldImage, record.Dynamodb.NewImage) {
+		if ignoredBy(change.Path, c.Ignore) {
+			continue
+		}
+		if len(c.Paths) == 0 || matchesAny(change.Path, c.Paths) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(changePath string, paths []string) bool {
+	for _, path := range paths {
+		if overlaps(changePath, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoredBy reports whether a change at changePath is at or beneath one of paths; a
+// change to a parent of an ignored path is not ignored, since it may touch siblings
+func ignoredBy(changePath string, paths []string) bool {
+	change := splitPath(changePath)
+	for _, path := range paths {
+		if hasPathPrefix(change, splitPath(path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps reports whether a change at changePath touches path; either the change is
+// at or beneath path, or it replaced a parent of path
+func overlaps(changePath, path string) bool {
+	change, watched := splitPath(changePath), splitPath(path)
+	return hasPathPrefix(change, watched) || hasPathPrefix(watched, change)
+}
+
+// hasPathPrefix reports whether path is prefix or lies beneath it
+func hasPathPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
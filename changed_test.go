@@ -0,0 +1,169 @@
+package zephyr_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zephyr"
+)
+
+func TestChangedTopicNamer(t *testing.T) {
+	namer := zephyr.TopicNameFunc(func(record zephyr.Record) (string, error) {
+		return "orders", nil
+	})
+
+	oldImage := map[string]zephyr.AttributeValue{
+		"status":    {S: aws.String("pending")},
+		"version":   {N: aws.String("1")},
+		"updatedAt": {S: aws.String("2016-01-01")},
+		"address":   {M: map[string]zephyr.AttributeValue{"city": {S: aws.String("Seattle")}}},
+	}
+
+	testCases := map[string]struct {
+		Namer    *zephyr.ChangedTopicNamer
+		NewImage map[string]zephyr.AttributeValue
+		Expected string
+	}{
+		"watched path changed": {
+			Namer: zephyr.WhenChanged(namer, "status"),
+			NewImage: map[string]zephyr.AttributeValue{
+				"status":    {S: aws.String("shipped")},
+				"version":   {N: aws.String("2")},
+				"updatedAt": {S: aws.String("2016-01-02")},
+				"address":   {M: map[string]zephyr.AttributeValue{"city": {S: aws.String("Seattle")}}},
+			},
+			Expected: "orders",
+		},
+		"unwatched path changed": {
+			Namer: zephyr.WhenChanged(namer, "status"),
+			NewImage: map[string]zephyr.AttributeValue{
+				"status":    {S: aws.String("pending")},
+				"version":   {N: aws.String("1")},
+				"updatedAt": {S: aws.String("2016-01-01")},
+				"address":   {M: map[string]zephyr.AttributeValue{"city": {S: aws.String("Portland")}}},
+			},
+			Expected: "",
+		},
+		"nested change under watched parent": {
+			Namer: zephyr.WhenChanged(namer, "address"),
+			NewImage: map[string]zephyr.AttributeValue{
+				"status":    {S: aws.String("pending")},
+				"version":   {N: aws.String("1")},
+				"updatedAt": {S: aws.String("2016-01-01")},
+				"address":   {M: map[string]zephyr.AttributeValue{"city": {S: aws.String("Portland")}}},
+			},
+			Expected: "orders",
+		},
+		"parent removed under watched child": {
+			Namer: zephyr.WhenChanged(namer, "address.city"),
+			NewImage: map[string]zephyr.AttributeValue{
+				"status":    {S: aws.String("pending")},
+				"version":   {N: aws.String("1")},
+				"updatedAt": {S: aws.String("2016-01-01")},
+			},
+			Expected: "orders",
+		},
+		"only ignored paths changed": {
+			Namer: zephyr.WhenChanged(namer).Ignoring("updatedAt", "version"),
+			NewImage: map[string]zephyr.AttributeValue{
+				"status":    {S: aws.String("pending")},
+				"version":   {N: aws.String("2")},
+				"updatedAt": {S: aws.String("2016-01-02")},
+				"address":   {M: map[string]zephyr.AttributeValue{"city": {S: aws.String("Seattle")}}},
+			},
+			Expected: "",
+		},
+		"parent added above ignored path": {
+			Namer: zephyr.WhenChanged(namer).Ignoring("meta.updatedAt"),
+			NewImage: map[string]zephyr.AttributeValue{
+				"status":    {S: aws.String("pending")},
+				"version":   {N: aws.String("1")},
+				"updatedAt": {S: aws.String("2016-01-01")},
+				"address":   {M: map[string]zephyr.AttributeValue{"city": {S: aws.String("Seattle")}}},
+				"meta": {M: map[string]zephyr.AttributeValue{
+					"owner":     {S: aws.String("joe")},
+					"updatedAt": {S: aws.String("2016-01-02")},
+				}},
+			},
+			Expected: "orders",
+		},
+		"any change not ignored": {
+			Namer: zephyr.WhenChanged(namer).Ignoring("updatedAt", "version"),
+			NewImage: map[string]zephyr.AttributeValue{
+				"status":    {S: aws.String("shipped")},
+				"version":   {N: aws.String("2")},
+				"updatedAt": {S: aws.String("2016-01-02")},
+				"address":   {M: map[string]zephyr.AttributeValue{"city": {S: aws.String("Seattle")}}},
+			},
+			Expected: "orders",
+		},
+	}
+
+	for label, tc := range testCases {
+		// Given
+		record := zephyr.Record{
+			EventName: zephyr.Modify,
+			Dynamodb: zephyr.StreamRecord{
+				OldImage: oldImage,
+				NewImage: tc.NewImage,
+			},
+		}
+
+		// When
+		topicName, err := tc.Namer.TopicName(record)
+
+		// Then
+		if err != nil {
+			t.Errorf("%v: expected nil error; got %v", label, err)
+		}
+		if topicName != tc.Expected {
+			t.Errorf("%v: expected %#v; got %#v", label, tc.Expected, topicName)
+		}
+	}
+}
+
+func TestChangedTopicNamerListPaths(t *testing.T) {
+	namer := zephyr.TopicNameFunc(func(record zephyr.Record) (string, error) {
+		return "orders", nil
+	})
+
+	record := zephyr.Record{
+		EventName: zephyr.Modify,
+		Dynamodb: zephyr.StreamRecord{
+			OldImage: map[string]zephyr.AttributeValue{
+				"lines": {L: []zephyr.AttributeValue{
+					{M: map[string]zephyr.AttributeValue{"qty": {N: aws.String("1")}}},
+				}},
+			},
+			NewImage: map[string]zephyr.AttributeValue{
+				"lines": {L: []zephyr.AttributeValue{
+					{M: map[string]zephyr.AttributeValue{"qty": {N: aws.String("2")}}},
+				}},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		Namer    *zephyr.ChangedTopicNamer
+		Expected string
+	}{
+		"watched with brackets": {Namer: zephyr.WhenChanged(namer, "lines[0].qty"), Expected: "orders"},
+		"watched with dots":     {Namer: zephyr.WhenChanged(namer, "lines.0.qty"), Expected: "orders"},
+		"other element watched": {Namer: zephyr.WhenChanged(namer, "lines.1.qty"), Expected: ""},
+		"ignored with dots":     {Namer: zephyr.WhenChanged(namer).Ignoring("lines.0.qty"), Expected: ""},
+		"ignored with brackets": {Namer: zephyr.WhenChanged(namer).Ignoring("lines[0]"), Expected: ""},
+	}
+
+	for label, tc := range testCases {
+		// When
+		topicName, err := tc.Namer.TopicName(record)
+
+		// Then
+		if err != nil {
+			t.Errorf("%v: expected nil error; got %v", label, err)
+		}
+		if topicName != tc.Expected {
+			t.Errorf("%v: expected %#v; got %#v", label, tc.Expected, topicName)
+		}
+	}
+}
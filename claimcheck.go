@@ -0,0 +1,200 @@
+package zephyr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const (
+	// MaxMessageSize is the largest message, body and attributes, SNS accepts
+	MaxMessageSize = 256 * 1024
+
+	// DefaultClaimCheckThreshold leaves room under MaxMessageSize for message attributes
+	DefaultClaimCheckThreshold = MaxMessageSize - 16*1024
+)
+
+var (
+	ErrInvalidLocation = errors.New("zephyr:err:invalid_location")
+)
+
+// BlobStore holds message bodies too large to publish directly
+type BlobStore interface {
+	// PutBlob stores data under key and returns its location
+	PutBlob(key string, data []byte) (string, error)
+
+	// GetBlob returns the data at a location previously returned by PutBlob
+	GetBlob(location string) ([]byte, error)
+}
+
+// ClaimCheck is published in place of a message body that was offloaded to a BlobStore.
+// ContentType is the MessageEncoder's content type when the offloaded body is encoded.
+type ClaimCheck struct {
+	Location    string `json:"location"`
+	Size        int    `json:"size"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+type claimCheckEnvelope struct {
+	ClaimCheck *ClaimCheck `json:"zephyrClaimCheck"`
+}
+
+// claimCheck stores body in the BlobStore and returns the envelope to publish in its
+// place; suffix distinguishes the bodies of a record extracted separately per topic
+func (h *Handler) claimCheck(record Record, suffix, body, contentType string) (string, error) {
+	key := record.EventID
+	if key == "" {
+		sum := sha256.Sum256([]byte(body))
+		key = hex.EncodeToString(sum[:])
+	}
+	if tableName, ok := TableName(record); ok {
+		key = tableName + "/" + key
+	}
+	if suffix != "" {
+		key = key + "/" + suffix
+	}
+
+	location, err := h.blobs.PutBlob(key, []byte(body))
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(claimCheckEnvelope{
+		ClaimCheck: &ClaimCheck{
+			Location:    location,
+			Size:        len(body),
+			ContentType: contentType,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// ParseClaimCheck returns the ClaimCheck within message, if message is a claim check envelope
+func ParseClaimCheck(message string) (*ClaimCheck, bool) {
+	if !strings.Contains(message, `"zephyrClaimCheck"`) {
+		return nil, false
+	}
+
+	var envelope claimCheckEnvelope
+	if err := json.Unmarshal([]byte(message), &envelope); err != nil || envelope.ClaimCheck == nil {
+		return nil, false
+	}
+
+	return envelope.ClaimCheck, true
+}
+
+// ResolveClaimCheck is for subscribers; it returns the original message body, fetching it
+// from store when message is a claim check and returning message unchanged otherwise
+func ResolveClaimCheck(message string, store BlobStore) (string, error) {
+	claimCheck, ok := ParseClaimCheck(message)
+	if !ok {
+		return message, nil
+	}
+
+	data, err := store.GetBlob(claimCheck.Location)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// ---- Dir ---------------------------------------------------------------------
+
+// DirBlobStore keeps blobs in a local directory; useful for tests and local development
+type DirBlobStore struct {
+	Dir string
+}
+
+func (s *DirBlobStore) PutBlob(key string, data []byte) (string, error) {
+	filename := filepath.Join(s.Dir, filepath.FromSlash(key))
+
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	err = ioutil.WriteFile(filename, data, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return "file://" + filepath.ToSlash(filename), nil
+}
+
+func (s *DirBlobStore) GetBlob(location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "file://") {
+		return nil, ErrInvalidLocation
+	}
+
+	filename := filepath.Clean(filepath.FromSlash(location[len("file://"):]))
+	if !strings.HasPrefix(filename, filepath.Clean(s.Dir)+string(filepath.Separator)) {
+		return nil, ErrInvalidLocation
+	}
+
+	return ioutil.ReadFile(filename)
+}
+
+func NewDirBlobStore(dir string) (*DirBlobStore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DirBlobStore{
+		Dir: dir,
+	}, nil
+}
+
+// ---- S3 ----------------------------------------------------------------------
+
+// S3BlobStore keeps blobs in an S3 bucket; locations are of the form s3://bucket/key
+type S3BlobStore struct {
+	Bucket string
+	Prefix string
+	client *s3Client
+}
+
+func (s *S3BlobStore) PutBlob(key string, data []byte) (string, error) {
+	key = path.Join(s.Prefix, key)
+
+	err := s.client.PutObject(s.Bucket, key, "application/octet-stream", data)
+	if err != nil {
+		return "", err
+	}
+
+	return "s3://" + s.Bucket + "/" + key, nil
+}
+
+func (s *S3BlobStore) GetBlob(location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "s3://") {
+		return nil, ErrInvalidLocation
+	}
+
+	segments := strings.SplitN(location[len("s3://"):], "/", 2)
+	if len(segments) != 2 || segments[0] == "" || segments[1] == "" {
+		return nil, ErrInvalidLocation
+	}
+
+	return s.client.GetObject(segments[0], segments[1])
+}
+
+func NewS3BlobStore(bucket, prefix string) *S3BlobStore {
+	return &S3BlobStore{
+		Bucket: bucket,
+		Prefix: prefix,
+		client: newS3Client(session.New(awsConfig())),
+	}
+}
@@ -0,0 +1,100 @@
+package zephyr_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zap"
+	"github.com/savaki/zephyr"
+)
+
+func TestClaimCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zephyr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := zephyr.NewDirBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := `
+{
+	"Records": [
+		{ "eventID": "small", "dynamodb": { "SequenceNumber": "100" } },
+		{ "eventID": "large", "eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/label", "dynamodb": { "SequenceNumber": "200" } }
+	]
+}`
+
+	large := strings.Repeat("x", 100)
+	published := map[string]string{}
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return record.EventID, nil
+		}),
+		zephyr.WithMessageExtractor(zephyr.ExtractMessageFunc(func(record zephyr.Record) (string, error) {
+			if record.EventID == "large" {
+				return large, nil
+			}
+			return "hello", nil
+		})),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			published[*topicArn] = message
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+		zephyr.WithClaimCheck(store, 50),
+	)
+
+	// When
+	_, err = handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if published["small"] != "hello" {
+		t.Errorf("expected hello; got %v", published["small"])
+	}
+
+	claimCheck, ok := zephyr.ParseClaimCheck(published["large"])
+	if !ok {
+		t.Fatalf("expected claim check; got %v", published["large"])
+	}
+	if claimCheck.Size != len(large) {
+		t.Errorf("expected size %v; got %v", len(large), claimCheck.Size)
+	}
+	if !strings.HasSuffix(claimCheck.Location, "/orders/large") {
+		t.Errorf("expected location to end with /orders/large; got %v", claimCheck.Location)
+	}
+
+	for _, m := range []string{published["small"], published["large"]} {
+		resolved, err := zephyr.ResolveClaimCheck(m, store)
+		if err != nil {
+			t.Errorf("expected nil error; got %v", err)
+		}
+		if resolved != "hello" && resolved != large {
+			t.Errorf("expected original message; got %v", resolved)
+		}
+	}
+}
+
+func TestDirBlobStoreRejectsOutsideLocations(t *testing.T) {
+	store := &zephyr.DirBlobStore{Dir: "/tmp/blobs"}
+
+	for _, location := range []string{"file:///etc/passwd", "file:///tmp/blobs/../secret", "s3://bucket/key"} {
+		if _, err := store.GetBlob(location); err != zephyr.ErrInvalidLocation {
+			t.Errorf("%v: expected ErrInvalidLocation; got %v", location, err)
+		}
+	}
+}
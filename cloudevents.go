@@ -0,0 +1,112 @@
+package zephyr
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// CloudEventsSpecVersion is the version of the CloudEvents spec envelopes follow
+	CloudEventsSpecVersion = "1.0"
+
+	// CloudEventsContentType is the content type of a structured CloudEvent
+	CloudEventsContentType = "application/cloudevents+json"
+)
+
+// CloudEventsOptions configures the envelope WithCloudEvents wraps messages in
+type CloudEventsOptions struct {
+	// DataSchema returns the URI of the schema the data for topicName adheres to; an
+	// empty string omits dataschema
+	DataSchema func(topicName string, record Record) string
+}
+
+// CloudEvent is a CloudEvents 1.0 event in structured JSON mode.  Data holds the
+// extracted message, inline when it is JSON or as a string otherwise; messages published
+// with a MessageEncoder are held, base64 encoded, in DataBase64 instead.  When the message
+// was offloaded WithClaimCheck, Data holds the claim check; pass it to ResolveClaimCheck.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// NewCloudEvent wraps body, the message extracted for topicName, in a CloudEvent:
+//
+//   - id is the record's EventID
+//   - source is the table arn, the EventSourceARN without its /stream/ suffix
+//   - type is the event name and topic, e.g. INSERT.orders
+//   - subject is the record's Keys as natural JSON
+//   - time is the ApproximateCreationDateTime of the change, or now when it's absent
+func NewCloudEvent(topicName string, record Record, body string, opts CloudEventsOptions) (string, error) {
+	return newCloudEvent(topicName, record, body, "", opts)
+}
+
+// newCloudEvent is NewCloudEvent for a body that, when contentType is set, is binary data
+// of that type, base64 encoded
+func newCloudEvent(topicName string, record Record, body, contentType string, opts CloudEventsOptions) (string, error) {
+	event := CloudEvent{
+		SpecVersion: CloudEventsSpecVersion,
+		ID:          record.EventID,
+		Source:      tableArn(record.EventSourceARN),
+		Type:        record.EventName + "." + topicName,
+		Time:        eventTime(record).Format(time.RFC3339Nano),
+	}
+
+	if len(record.Dynamodb.Keys) > 0 {
+		subject, err := MarshalPlainImage(record.Dynamodb.Keys)
+		if err != nil {
+			return "", err
+		}
+		event.Subject = string(subject)
+	}
+
+	if opts.DataSchema != nil {
+		event.DataSchema = opts.DataSchema(topicName, record)
+	}
+
+	switch {
+	case contentType != "":
+		event.DataContentType = contentType
+		event.DataBase64 = body
+	case json.Valid([]byte(body)):
+		event.DataContentType = "application/json"
+		event.Data = json.RawMessage(body)
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+		event.DataContentType = "text/plain"
+		event.Data = data
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func tableArn(eventSourceARN string) string {
+	if i := strings.Index(eventSourceARN, "/stream/"); i >= 0 {
+		return eventSourceARN[:i]
+	}
+	return eventSourceARN
+}
+
+func eventTime(record Record) time.Time {
+	if t := record.Dynamodb.ApproximateCreationDateTime; t > 0 {
+		seconds, fraction := math.Modf(t)
+		return time.Unix(int64(seconds), int64(fraction*1e9)).UTC()
+	}
+	return time.Now().UTC()
+}
@@ -0,0 +1,229 @@
+package zephyr_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zap"
+	"github.com/savaki/zephyr"
+)
+
+func TestWithCloudEvents(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{
+			"eventID": "abc",
+			"eventName": "INSERT",
+			"eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/2016-05-16T22:22:50.550",
+			"dynamodb": {
+				"ApproximateCreationDateTime": 1479499740,
+				"Keys": { "id": { "S": "123" } },
+				"SequenceNumber": "100"
+			}
+		}
+	]
+}`
+
+	testCases := map[string]struct {
+		Body            string
+		DataContentType string
+		Data            string
+	}{
+		"json": {
+			Body:            `{"id":"123"}`,
+			DataContentType: "application/json",
+			Data:            `{"id":"123"}`,
+		},
+		"text": {
+			Body:            "shipped",
+			DataContentType: "text/plain",
+			Data:            `"shipped"`,
+		},
+	}
+
+	for label, tc := range testCases {
+		var published string
+
+		// Given
+		handler := zephyr.New(
+			zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+				return "orders", nil
+			}),
+			zephyr.WithMessageExtractor(zephyr.ExtractMessageFunc(func(record zephyr.Record) (string, error) {
+				return tc.Body, nil
+			})),
+			zephyr.WithCloudEvents(zephyr.CloudEventsOptions{
+				DataSchema: func(topicName string, record zephyr.Record) string {
+					return "https://example.com/schemas/" + topicName + ".json"
+				},
+			}),
+			zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+				published = message
+				return nil
+			}),
+			zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+				return aws.String(topicName), nil
+			}),
+		)
+
+		// When
+		_, err := handler.Handle(json.RawMessage(message), nil)
+
+		// Then
+		if err != nil {
+			t.Fatalf("%v: expected nil error; got %v", label, err)
+		}
+
+		var event zephyr.CloudEvent
+		if err := json.Unmarshal([]byte(published), &event); err != nil {
+			t.Fatalf("%v: expected nil error; got %v", label, err)
+		}
+
+		expected := zephyr.CloudEvent{
+			SpecVersion:     "1.0",
+			ID:              "abc",
+			Source:          "arn:aws:dynamodb:us-east-1:123456789012:table/orders",
+			Type:            "INSERT.orders",
+			Subject:         `{"id":"123"}`,
+			Time:            "2016-11-18T20:09:00Z",
+			DataContentType: tc.DataContentType,
+			DataSchema:      "https://example.com/schemas/orders.json",
+			Data:            json.RawMessage(tc.Data),
+		}
+		if !reflect.DeepEqual(expected, event) {
+			t.Errorf("%v: expected %#v; got %#v", label, expected, event)
+		}
+	}
+}
+
+func TestCloudEventsUseTransformedRecord(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{
+			"eventID": "abc",
+			"eventName": "INSERT",
+			"dynamodb": {
+				"Keys": { "email": { "S": "joe@example.com" } },
+				"NewImage": { "email": { "S": "joe@example.com" } },
+				"SequenceNumber": "100"
+			}
+		}
+	]
+}`
+
+	var published string
+	var schemaKey string
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return "orders", nil
+		}),
+		zephyr.WithTransform("*", zephyr.Mask("email")),
+		zephyr.WithCloudEvents(zephyr.CloudEventsOptions{
+			DataSchema: func(topicName string, record zephyr.Record) string {
+				schemaKey = *record.Dynamodb.Keys["email"].S
+				return ""
+			},
+		}),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			published = message
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	var event zephyr.CloudEvent
+	if err := json.Unmarshal([]byte(published), &event); err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if expected := `{"email":"****"}`; event.Subject != expected {
+		t.Errorf("expected %v; got %v", expected, event.Subject)
+	}
+	if schemaKey != zephyr.MaskValue {
+		t.Errorf("expected %v; got %v", zephyr.MaskValue, schemaKey)
+	}
+}
+
+func TestCloudEventsWrapClaimCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zephyr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := zephyr.NewDirBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := `
+{
+	"Records": [
+		{ "eventID": "large", "eventName": "INSERT", "dynamodb": { "SequenceNumber": "100" } }
+	]
+}`
+
+	large := `{"text":"` + strings.Repeat("x", 100) + `"}`
+	var published string
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return "orders", nil
+		}),
+		zephyr.WithMessageExtractor(zephyr.ExtractMessageFunc(func(record zephyr.Record) (string, error) {
+			return large, nil
+		})),
+		zephyr.WithCloudEvents(zephyr.CloudEventsOptions{}),
+		zephyr.WithClaimCheck(store, 50),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			published = message
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	_, err = handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	var event zephyr.CloudEvent
+	if err := json.Unmarshal([]byte(published), &event); err != nil {
+		t.Fatalf("expected CloudEvent; got %v", published)
+	}
+	if event.Type != "INSERT.orders" {
+		t.Errorf("expected INSERT.orders; got %v", event.Type)
+	}
+
+	resolved, err := zephyr.ResolveClaimCheck(string(event.Data), store)
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if resolved != large {
+		t.Errorf("expected %v; got %v", large, resolved)
+	}
+}
@@ -0,0 +1,168 @@
+package zephyr
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/savaki/zap"
+	"golang.org/x/net/context"
+)
+
+// ErrPrecedingRecordFailed is reported for records that were not published because an
+// earlier record with the same Keys failed; publishing them would break per-key ordering
+var ErrPrecedingRecordFailed = errors.New("zephyr:err:preceding_record_failed")
+
+// handleRecords processes records and returns the error, if any, for each record by index.
+// When concurrency is greater than 1, records are grouped by Keys; groups are published in
+// parallel while the records within a group are published in SequenceNumber order.
+// Either way, records that follow a failed record with the same Keys fail with
+// ErrPrecedingRecordFailed, and records not yet started when the deadline passes fail
+// with ErrDeadlineExceeded.
+func (h *Handler) handleRecords(ctx context.Context, records []Record, deadline time.Time) []error {
+	errs := make([]error, len(records))
+
+	if h.concurrency <= 1 {
+		failed := map[string]bool{}
+		for i, record := range records {
+			if h.expired(deadline) {
+				errs[i] = ErrDeadlineExceeded
+				continue
+			}
+
+			key := recordKey(record)
+			if failed[key] {
+				h.log.Warn("zephyr:err:preceding_record_failed", zap.String("seq", record.Dynamodb.SequenceNumber))
+				errs[i] = ErrPrecedingRecordFailed
+				continue
+			}
+
+			errs[i] = h.handleRecord(ctx, record)
+			if errs[i] != nil {
+				if !h.partialBatchResponse {
+					// the whole batch is retried; publishing the rest would only duplicate it
+					return errs
+				}
+				failed[key] = true
+			}
+		}
+		return errs
+	}
+
+	groups := groupByKeys(records)
+
+	workers := h.concurrency
+	if workers > len(groups) {
+		workers = len(groups)
+	}
+
+	ch := make(chan []int)
+	wg := &sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for group := range ch {
+				h.handleGroup(ctx, records, group, errs, deadline)
+			}
+		}()
+	}
+
+	for _, group := range groups {
+		ch <- group
+	}
+	close(ch)
+	wg.Wait()
+
+	return errs
+}
+
+func (h *Handler) handleGroup(ctx context.Context, records []Record, group []int, errs []error, deadline time.Time) {
+	var failed bool
+	for _, i := range group {
+		if h.expired(deadline) {
+			errs[i] = ErrDeadlineExceeded
+			continue
+		}
+
+		if failed {
+			h.log.Warn("zephyr:err:preceding_record_failed", zap.String("seq", records[i].Dynamodb.SequenceNumber))
+			errs[i] = ErrPrecedingRecordFailed
+			continue
+		}
+
+		errs[i] = h.handleRecord(ctx, records[i])
+		failed = errs[i] != nil
+	}
+}
+
+// groupByKeys returns the indexes of records that share the same Keys, each group sorted
+// by SequenceNumber; groups are ordered by first appearance
+func groupByKeys(records []Record) [][]int {
+	var groups [][]int
+	index := map[string]int{}
+
+	for i, record := range records {
+		key := recordKey(record)
+
+		g, ok := index[key]
+		if !ok {
+			g = len(groups)
+			index[key] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+
+	for _, group := range groups {
+		sort.SliceStable(group, func(a, b int) bool {
+			return lessSequenceNumber(records[group[a]].Dynamodb.SequenceNumber, records[group[b]].Dynamodb.SequenceNumber)
+		})
+	}
+
+	return groups
+}
+
+// recordKey identifies the item a record changed
+func recordKey(record Record) string {
+	data, _ := json.Marshal(record.Dynamodb.Keys) // map keys are sorted by encoding/json
+	return string(data)
+}
+
+// lessSequenceNumber compares the decimal strings DynamoDB uses for sequence numbers
+func lessSequenceNumber(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// lockedWriteSyncer serializes writes from concurrent loggers
+type lockedWriteSyncer struct {
+	mux *sync.Mutex
+	w   zap.WriteSyncer
+}
+
+func (l *lockedWriteSyncer) Write(p []byte) (int, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	return l.w.Write(p)
+}
+
+func (l *lockedWriteSyncer) Sync() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	return l.w.Sync()
+}
+
+func newLockedWriteSyncer(w io.Writer) zap.WriteSyncer {
+	return &lockedWriteSyncer{
+		mux: &sync.Mutex{},
+		w:   zap.AddSync(w),
+	}
+}
@@ -0,0 +1,44 @@
+package zephyr
+
+import (
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+)
+
+type contextKey int
+
+const lambdaContextKey contextKey = iota
+
+// LambdaContext returns the Lambda invocation context, which carries the request id,
+// from the context passed to the context aware interfaces
+func LambdaContext(ctx context.Context) (*apex.Context, bool) {
+	v, ok := ctx.Value(lambdaContextKey).(*apex.Context)
+	return v, ok
+}
+
+// newContext returns the context for an invocation.  When the handler has a timeout,
+// the context is cancelled halfway through the safety margin; records stop being
+// started at the margin, and cancelling in flight calls leaves time to respond.
+func (h *Handler) newContext(lambda *apex.Context) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if lambda != nil {
+		ctx = context.WithValue(ctx, lambdaContextKey, lambda)
+	}
+
+	if h.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, h.timeout-h.safetyMargin/2)
+}
+
+// topicMessageExtractor returns the extractor as a TopicMessageExtractor, looking
+// through the adapter that makes a MessageExtractor context aware
+func (h *Handler) topicMessageExtractor() (TopicMessageExtractor, bool) {
+	var v interface{} = h.extractor
+	if e, ok := v.(messageExtractorContext); ok {
+		v = e.MessageExtractor
+	}
+
+	te, ok := v.(TopicMessageExtractor)
+	return te, ok
+}
@@ -0,0 +1,137 @@
+package zephyr_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/apex/go-apex"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zap"
+	"github.com/savaki/zephyr"
+	"golang.org/x/net/context"
+)
+
+// contextRouter implements both the plain and context aware interfaces
+type contextRouter struct {
+	requestIDs []string
+}
+
+func (r *contextRouter) TopicName(record zephyr.Record) (string, error) {
+	return "", errors.New("expected TopicNameContext")
+}
+
+func (r *contextRouter) TopicNameContext(ctx context.Context, record zephyr.Record) (string, error) {
+	r.observe(ctx)
+	return "orders", nil
+}
+
+func (r *contextRouter) ExtractMessage(record zephyr.Record) (string, error) {
+	return "", errors.New("expected ExtractMessageContext")
+}
+
+func (r *contextRouter) ExtractMessageContext(ctx context.Context, record zephyr.Record) (string, error) {
+	r.observe(ctx)
+	return "hello", nil
+}
+
+func (r *contextRouter) Publish(logger zap.Logger, topicArn *string, message string) error {
+	return errors.New("expected PublishContext")
+}
+
+func (r *contextRouter) PublishContext(ctx context.Context, logger zap.Logger, topicArn *string, message string) error {
+	r.observe(ctx)
+	return nil
+}
+
+func (r *contextRouter) FindTopicArn(topicName string) (*string, error) {
+	return nil, errors.New("expected FindTopicArnContext")
+}
+
+func (r *contextRouter) FindTopicArnContext(ctx context.Context, topicName string) (*string, error) {
+	r.observe(ctx)
+	return aws.String(topicName), nil
+}
+
+func (r *contextRouter) observe(ctx context.Context) {
+	if lambda, ok := zephyr.LambdaContext(ctx); ok {
+		r.requestIDs = append(r.requestIDs, lambda.RequestID)
+	}
+}
+
+func TestContextInterfaces(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "dynamodb": { "SequenceNumber": "100" } }
+	]
+}`
+
+	// Given
+	router := &contextRouter{}
+	handler := zephyr.New(
+		zephyr.WithPartialBatchResponse(),
+		zephyr.WithHandler(router),
+	)
+
+	// When
+	v, err := handler.Handle(json.RawMessage(message), &apex.Context{RequestID: "abc"})
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if failures := v.(*zephyr.BatchResponse).BatchItemFailures; len(failures) != 0 {
+		t.Errorf("expected no failures; got %v", failures)
+	}
+	if expected := 4; len(router.requestIDs) != expected {
+		t.Errorf("expected %v context aware calls; got %v", expected, router.requestIDs)
+	}
+	for _, requestID := range router.requestIDs {
+		if requestID != "abc" {
+			t.Errorf("expected request id abc; got %v", requestID)
+		}
+	}
+}
+
+func TestContextFuncs(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "dynamodb": { "SequenceNumber": "100" } }
+	]
+}`
+
+	var published string
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNamerContext(zephyr.TopicNameContextFunc(func(ctx context.Context, record zephyr.Record) (string, error) {
+			return "orders", nil
+		})),
+		zephyr.WithMessageExtractorContext(zephyr.ExtractMessageContextFunc(func(ctx context.Context, record zephyr.Record) (string, error) {
+			return "hello", nil
+		})),
+		zephyr.WithMessagePublisherContext(zephyr.PublishMessageContextFunc(func(ctx context.Context, logger zap.Logger, topicArn *string, message zephyr.Message) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			published = *topicArn + ":" + message.Body
+			return nil
+		})),
+		zephyr.WithTopicArnFinderContext(zephyr.FindTopicArnContextFunc(func(ctx context.Context, topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		})),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if expected := "orders:hello"; published != expected {
+		t.Errorf("expected %v; got %v", expected, published)
+	}
+}
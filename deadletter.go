@@ -0,0 +1,107 @@
+package zephyr
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const (
+	// StageTopicName indicates the TopicNamer failed
+	StageTopicName = "topic_name"
+
+	// StageExtractMessage indicates the MessageExtractor failed
+	StageExtractMessage = "extract_message"
+
+	// StageMessageAttributes indicates the MessageAttributer failed
+	StageMessageAttributes = "message_attributes"
+
+	// StageTopicNotFound indicates the topic does not exist; see UnknownTopicDeadLetter
+	StageTopicNotFound = "topic_not_found"
+
+	// StageClaimCheck indicates an oversized message could not be stored in the BlobStore
+	StageClaimCheck = "claim_check"
+)
+
+// DeadLetter is the envelope written by the bundled DeadLetterSinks
+type DeadLetter struct {
+	Stage     string    `json:"stage"`
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
+	Record    Record    `json:"record"`
+}
+
+func marshalDeadLetter(record Record, stage string, err error) ([]byte, error) {
+	return json.Marshal(DeadLetter{
+		Stage:     stage,
+		Error:     err.Error(),
+		Timestamp: time.Now().UTC(),
+		Record:    record,
+	})
+}
+
+// ---- SQS ---------------------------------------------------------------------
+
+// SQSDeadLetterSink sends dead letters to an SQS queue
+type SQSDeadLetterSink struct {
+	QueueURL string
+	send     func(queueURL, body string) error
+}
+
+func (s *SQSDeadLetterSink) DeadLetter(record Record, stage string, err error) error {
+	data, err := marshalDeadLetter(record, stage, err)
+	if err != nil {
+		return err
+	}
+
+	return s.send(s.QueueURL, string(data))
+}
+
+func NewSQSDeadLetterSink(queueURL string) *SQSDeadLetterSink {
+	client := newSQSClient(session.New(awsConfig()))
+
+	return &SQSDeadLetterSink{
+		QueueURL: queueURL,
+		send:     client.SendMessage,
+	}
+}
+
+// ---- File --------------------------------------------------------------------
+
+// FileDeadLetterSink appends dead letters to a local file, one JSON document per line
+type FileDeadLetterSink struct {
+	file *os.File
+	mux  *sync.Mutex
+}
+
+func (s *FileDeadLetterSink) DeadLetter(record Record, stage string, err error) error {
+	data, err := marshalDeadLetter(record, stage, err)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *FileDeadLetterSink) Close() error {
+	return s.file.Close()
+}
+
+func NewFileDeadLetterSink(filename string) (*FileDeadLetterSink, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileDeadLetterSink{
+		file: f,
+		mux:  &sync.Mutex{},
+	}, nil
+}
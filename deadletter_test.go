@@ -0,0 +1,122 @@
+package zephyr_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zap"
+	"github.com/savaki/zephyr"
+)
+
+func TestDeadLetter(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "eventID": "name",    "dynamodb": { "SequenceNumber": "100" } },
+		{ "eventID": "extract", "dynamodb": { "SequenceNumber": "200" } },
+		{ "eventID": "ok",      "dynamodb": { "SequenceNumber": "300" } }
+	]
+}`
+
+	stages := map[string]string{}
+	var publishCount int
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithPartialBatchResponse(),
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			if record.EventID == "name" {
+				return "", errors.New("unroutable")
+			}
+			return "blah", nil
+		}),
+		zephyr.WithMessageExtractor(zephyr.ExtractMessageFunc(func(record zephyr.Record) (string, error) {
+			if record.EventID == "extract" {
+				return "", errors.New("unextractable")
+			}
+			return "hello", nil
+		})),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			publishCount++
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+		zephyr.WithDeadLetterFunc(func(record zephyr.Record, stage string, err error) error {
+			stages[record.EventID] = stage
+			return nil
+		}),
+	)
+
+	// When
+	v, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if failures := v.(*zephyr.BatchResponse).BatchItemFailures; len(failures) != 0 {
+		t.Errorf("expected no failures; got %v", failures)
+	}
+	if publishCount != 1 {
+		t.Errorf("expected publishCount == 1; got %v", publishCount)
+	}
+	if stages["name"] != zephyr.StageTopicName {
+		t.Errorf("expected %v; got %v", zephyr.StageTopicName, stages["name"])
+	}
+	if stages["extract"] != zephyr.StageExtractMessage {
+		t.Errorf("expected %v; got %v", zephyr.StageExtractMessage, stages["extract"])
+	}
+}
+
+func TestFileDeadLetterSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zephyr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "dead-letters.jsonl")
+	sink, err := zephyr.NewFileDeadLetterSink(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		err = sink.DeadLetter(zephyr.Record{EventID: id}, zephyr.StageTopicName, errors.New("boom"))
+		if err != nil {
+			t.Errorf("expected nil error; got %v", err)
+		}
+	}
+	sink.Close()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ids := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var v zephyr.DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Stage != zephyr.StageTopicName || v.Error != "boom" {
+			t.Errorf("unexpected dead letter, %#v", v)
+		}
+		ids = append(ids, v.Record.EventID)
+	}
+
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("expected [a b]; got %v", ids)
+	}
+}
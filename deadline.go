@@ -0,0 +1,62 @@
+package zephyr
+
+import (
+	"errors"
+	"time"
+
+	"github.com/savaki/zap"
+)
+
+// DefaultSafetyMargin is the time WithTimeout reserves, by default, to finish the
+// record in flight and return a response before Lambda stops the invocation
+const DefaultSafetyMargin = 2 * time.Second
+
+// TimeoutEnv is the environment variable WithTimeoutFromEnv reads the function timeout
+// from, a duration such as 30s; set it at deploy time alongside the function timeout
+const TimeoutEnv = "ZEPHYR_TIMEOUT"
+
+// ErrDeadlineExceeded is reported for records that were not started because the
+// invocation was about to time out; they are returned as batch item failures so only
+// they are retried
+var ErrDeadlineExceeded = errors.New("zephyr:err:deadline_exceeded")
+
+// deadline returns when the handler should stop taking new records, zero if the handler
+// has no timeout
+func (h *Handler) deadline(started time.Time) time.Time {
+	if h.timeout <= 0 {
+		return time.Time{}
+	}
+	return started.Add(h.timeout - h.safetyMargin)
+}
+
+// expired reports whether the deadline has passed
+func (h *Handler) expired(deadline time.Time) bool {
+	return !deadline.IsZero() && !h.now().Before(deadline)
+}
+
+// logProgress records how far the invocation got when it stopped at the deadline
+func (h *Handler) logProgress(records []Record, errs []error) {
+	var processed, unprocessed int
+	var first string
+	for i, err := range errs {
+		if err != ErrDeadlineExceeded {
+			processed++
+			continue
+		}
+
+		unprocessed++
+		if seq := records[i].Dynamodb.SequenceNumber; first == "" || lessSequenceNumber(seq, first) {
+			first = seq
+		}
+	}
+
+	if unprocessed == 0 {
+		return
+	}
+
+	h.log.Warn("zephyr:err:deadline_exceeded",
+		zap.Int("processed", processed),
+		zap.Int("unprocessed", unprocessed),
+		zap.String("first_unprocessed_seq", first),
+	)
+}
@@ -0,0 +1,138 @@
+package zephyr
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zap"
+)
+
+func TestDeadline(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "dynamodb": { "Keys": { "id": { "S": "a" } }, "SequenceNumber": "100" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "b" } }, "SequenceNumber": "101" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "c" } }, "SequenceNumber": "102" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "d" } }, "SequenceNumber": "103" } }
+	]
+}`
+
+	clock := time.Unix(1479499740, 0)
+	w := &bytes.Buffer{}
+	published := 0
+
+	// Given - each publish takes 3s and 8s are usable
+	handler := New(
+		WithPartialBatchResponse(),
+		WithTimeout(10*time.Second, 2*time.Second),
+		WithTopicNameFunc(func(record Record) (string, error) {
+			return "orders", nil
+		}),
+		WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			published++
+			clock = clock.Add(3 * time.Second)
+			return nil
+		}),
+		WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+		Output(w),
+		func(h *Handler) { h.now = func() time.Time { return clock } },
+	)
+
+	// When
+	v, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if published != 3 {
+		t.Errorf("expected 3 records published; got %v", published)
+	}
+	failures := v.(*BatchResponse).BatchItemFailures
+	if len(failures) != 1 || failures[0].ItemIdentifier != "103" {
+		t.Errorf("expected 103 to be reported as failed; got %v", failures)
+	}
+	if !strings.Contains(w.String(), `"processed":3,"unprocessed":1,"first_unprocessed_seq":"103"`) {
+		t.Errorf("expected progress to be logged; got %v", w.String())
+	}
+}
+
+func TestDeadlineWithoutPartialResponse(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "dynamodb": { "Keys": { "id": { "S": "a" } }, "SequenceNumber": "100" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "b" } }, "SequenceNumber": "101" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "c" } }, "SequenceNumber": "102" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "d" } }, "SequenceNumber": "103" } }
+	]
+}`
+
+	clock := time.Unix(1479499740, 0)
+	published := 0
+
+	// Given - each publish takes 3s and 8s are usable
+	handler := New(
+		WithTimeout(10*time.Second, 2*time.Second),
+		WithTopicNameFunc(func(record Record) (string, error) {
+			return "orders", nil
+		}),
+		WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			published++
+			clock = clock.Add(3 * time.Second)
+			return nil
+		}),
+		WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+		func(h *Handler) { h.now = func() time.Time { return clock } },
+	)
+
+	// When
+	v, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then - the whole batch is retried
+	if err != ErrDeadlineExceeded {
+		t.Errorf("expected %v; got %v", ErrDeadlineExceeded, err)
+	}
+	if v != nil {
+		t.Errorf("expected nil response; got %v", v)
+	}
+	if published != 3 {
+		t.Errorf("expected 3 records published; got %v", published)
+	}
+}
+
+func TestWithTimeoutFromEnv(t *testing.T) {
+	defer os.Setenv(TimeoutEnv, os.Getenv(TimeoutEnv))
+
+	testCases := map[string]struct {
+		Value    string
+		Expected time.Duration
+	}{
+		"set":     {Value: "30s", Expected: 30 * time.Second},
+		"unset":   {Value: ""},
+		"invalid": {Value: "thirty"},
+	}
+
+	for label, tc := range testCases {
+		os.Setenv(TimeoutEnv, tc.Value)
+
+		// When
+		h := &Handler{}
+		WithTimeoutFromEnv(0)(h)
+
+		// Then
+		if h.timeout != tc.Expected {
+			t.Errorf("%v: expected timeout %v; got %v", label, tc.Expected, h.timeout)
+		}
+	}
+}
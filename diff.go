@@ -0,0 +1,222 @@
+package zephyr
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// ChangeOp describes how an attribute differs between the OldImage and NewImage
+type ChangeOp string
+
+const (
+	Added    ChangeOp = "added"
+	Removed  ChangeOp = "removed"
+	Modified ChangeOp = "modified"
+)
+
+// Change is a single difference between two images.  Path names the attribute using
+// dots for nested maps and [i] for list elements, e.g. address.city or lines[2].qty; see
+// LookupAttribute for the path syntax.
+// Sets are compared as a whole, without regard to order.
+type Change struct {
+	Path string
+	Op   ChangeOp
+	Old  *AttributeValue
+	New  *AttributeValue
+}
+
+// Diff reports the attributes added, removed or modified between oldImage and newImage,
+// ordered by path
+func Diff(oldImage, newImage map[string]AttributeValue) []Change {
+	var changes []Change
+	diffMaps("", oldImage, newImage, &changes)
+	return changes
+}
+
+func diffMaps(prefix string, oldImage, newImage map[string]AttributeValue, changes *[]Change) {
+	keys := make([]string, 0, len(oldImage)+len(newImage))
+	for k := range oldImage {
+		keys = append(keys, k)
+	}
+	for k := range newImage {
+		if _, ok := oldImage[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+
+		ov, inOld := oldImage[k]
+		nv, inNew := newImage[k]
+		switch {
+		case !inOld:
+			*changes = append(*changes, Change{Path: path, Op: Added, New: &nv})
+		case !inNew:
+			*changes = append(*changes, Change{Path: path, Op: Removed, Old: &ov})
+		default:
+			diffValues(path, ov, nv, changes)
+		}
+	}
+}
+
+func diffValues(path string, ov, nv AttributeValue, changes *[]Change) {
+	switch {
+	case ov.M != nil && nv.M != nil:
+		diffMaps(path, ov.M, nv.M, changes)
+
+	case ov.L != nil && nv.L != nil:
+		for i := 0; i < len(ov.L) || i < len(nv.L); i++ {
+			itemPath := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(ov.L):
+				*changes = append(*changes, Change{Path: itemPath, Op: Added, New: &nv.L[i]})
+			case i >= len(nv.L):
+				*changes = append(*changes, Change{Path: itemPath, Op: Removed, Old: &ov.L[i]})
+			default:
+				diffValues(itemPath, ov.L[i], nv.L[i], changes)
+			}
+		}
+
+	default:
+		if !equalValues(ov, nv) {
+			*changes = append(*changes, Change{Path: path, Op: Modified, Old: &ov, New: &nv})
+		}
+	}
+}
+
+func equalValues(a, b AttributeValue) bool {
+	switch {
+	case a.SS != nil && b.SS != nil:
+		return equalSets(stringSet(a.SS), stringSet(b.SS))
+	case a.NS != nil && b.NS != nil:
+		return equalSets(numberSet(a.NS), numberSet(b.NS))
+	case a.BS != nil && b.BS != nil:
+		return equalSets(binarySet(a.BS), binarySet(b.BS))
+	case a.N != nil && b.N != nil:
+		return equalNumbers(*a.N, *b.N)
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+func equalNumbers(a, b string) bool {
+	if a == b {
+		return true
+	}
+	x, ok := new(big.Rat).SetString(a)
+	if !ok {
+		return false
+	}
+	y, ok := new(big.Rat).SetString(b)
+	return ok && x.Cmp(y) == 0
+}
+
+func equalSets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func stringSet(values []*string) []string {
+	set := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			set = append(set, *v)
+		}
+	}
+	return set
+}
+
+func numberSet(values []*string) []string {
+	set := stringSet(values)
+	for i, v := range set {
+		if r, ok := new(big.Rat).SetString(v); ok {
+			set[i] = r.RatString()
+		}
+	}
+	return set
+}
+
+func binarySet(values [][]byte) []string {
+	set := make([]string, len(values))
+	for i, v := range values {
+		set[i] = string(v)
+	}
+	return set
+}
+
+// ---- DiffExtractor -----------------------------------------------------------
+
+type diffChange struct {
+	Path string      `json:"path"`
+	Op   ChangeOp    `json:"op"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+type diffMessage struct {
+	EventID   string                 `json:"eventID"`
+	EventName string                 `json:"eventName"`
+	TableName string                 `json:"tableName,omitempty"`
+	Keys      map[string]interface{} `json:"keys"`
+	Changes   []diffChange           `json:"changes"`
+	NewImage  map[string]interface{} `json:"newImage,omitempty"`
+}
+
+// DiffExtractor is a MessageExtractor that publishes only what changed between the
+// OldImage and NewImage as natural JSON.  INSERT events report every attribute as
+// added and REMOVE events report every attribute as removed.
+type DiffExtractor struct {
+	// IncludeNewImage adds the complete NewImage to the message
+	IncludeNewImage bool
+}
+
+func (d DiffExtractor) ExtractMessage(record Record) (string, error) {
+	changes := Diff(record.Dynamodb.OldImage, record.Dynamodb.NewImage)
+
+	message := diffMessage{
+		EventID:   record.EventID,
+		EventName: record.EventName,
+		Keys:      PlainImage(record.Dynamodb.Keys),
+		Changes:   make([]diffChange, 0, len(changes)),
+	}
+	if tableName, ok := TableName(record); ok {
+		message.TableName = tableName
+	}
+	if d.IncludeNewImage {
+		message.NewImage = PlainImage(record.Dynamodb.NewImage)
+	}
+
+	for _, change := range changes {
+		c := diffChange{Path: change.Path, Op: change.Op}
+		if change.Old != nil {
+			c.Old = PlainValue(*change.Old)
+		}
+		if change.New != nil {
+			c.New = PlainValue(*change.New)
+		}
+		message.Changes = append(message.Changes, c)
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
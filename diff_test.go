@@ -0,0 +1,151 @@
+package zephyr_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zephyr"
+)
+
+func TestDiff(t *testing.T) {
+	// Given
+	oldImage := map[string]zephyr.AttributeValue{
+		"id":      {S: aws.String("abc")},
+		"status":  {S: aws.String("pending")},
+		"total":   {N: aws.String("10")},
+		"removed": {BOOL: aws.Bool(true)},
+		"tags":    {SS: []*string{aws.String("a"), aws.String("b")}},
+		"address": {M: map[string]zephyr.AttributeValue{
+			"city": {S: aws.String("Seattle")},
+			"zip":  {S: aws.String("98101")},
+		}},
+		"lines": {L: []zephyr.AttributeValue{
+			{M: map[string]zephyr.AttributeValue{"qty": {N: aws.String("1")}}},
+			{S: aws.String("gone")},
+		}},
+	}
+	newImage := map[string]zephyr.AttributeValue{
+		"id":     {S: aws.String("abc")},
+		"status": {S: aws.String("shipped")},
+		"total":  {N: aws.String("10.0")},
+		"added":  {N: aws.String("1")},
+		"tags":   {SS: []*string{aws.String("b"), aws.String("a")}},
+		"address": {M: map[string]zephyr.AttributeValue{
+			"city":  {S: aws.String("Portland")},
+			"state": {S: aws.String("OR")},
+		}},
+		"lines": {L: []zephyr.AttributeValue{
+			{M: map[string]zephyr.AttributeValue{"qty": {N: aws.String("2")}}},
+		}},
+	}
+
+	// When
+	changes := zephyr.Diff(oldImage, newImage)
+
+	// Then
+	var actual []string
+	for _, change := range changes {
+		actual = append(actual, string(change.Op)+":"+change.Path)
+	}
+	expected := []string{
+		"added:added",
+		"modified:address.city",
+		"added:address.state",
+		"removed:address.zip",
+		"modified:lines[0].qty",
+		"removed:lines[1]",
+		"removed:removed",
+		"modified:status",
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v; got %v", expected, actual)
+	}
+	if c := changes[1]; *c.Old.S != "Seattle" || *c.New.S != "Portland" {
+		t.Errorf("expected Seattle -> Portland; got %v -> %v", *c.Old.S, *c.New.S)
+	}
+}
+
+func TestDiffLargeNumbers(t *testing.T) {
+	testCases := map[string]struct {
+		Old      zephyr.AttributeValue
+		New      zephyr.AttributeValue
+		Modified bool
+	}{
+		"beyond float64": {
+			Old:      zephyr.AttributeValue{N: aws.String("12345678901234567890")},
+			New:      zephyr.AttributeValue{N: aws.String("12345678901234567891")},
+			Modified: true,
+		},
+		"number set beyond float64": {
+			Old:      zephyr.AttributeValue{NS: []*string{aws.String("9007199254740993")}},
+			New:      zephyr.AttributeValue{NS: []*string{aws.String("9007199254740992")}},
+			Modified: true,
+		},
+		"equivalent representations": {
+			Old: zephyr.AttributeValue{N: aws.String("12345678901234567890")},
+			New: zephyr.AttributeValue{N: aws.String("1.2345678901234567890E19")},
+		},
+		"equivalent number sets": {
+			Old: zephyr.AttributeValue{NS: []*string{aws.String("9007199254740993"), aws.String("1.50")}},
+			New: zephyr.AttributeValue{NS: []*string{aws.String("1.5"), aws.String("9007199254740993.0")}},
+		},
+	}
+
+	for label, tc := range testCases {
+		// When
+		changes := zephyr.Diff(
+			map[string]zephyr.AttributeValue{"n": tc.Old},
+			map[string]zephyr.AttributeValue{"n": tc.New},
+		)
+
+		// Then
+		if modified := len(changes) > 0; modified != tc.Modified {
+			t.Errorf("%v: expected modified %v; got %v", label, tc.Modified, changes)
+		}
+	}
+}
+
+func TestDiffExtractor(t *testing.T) {
+	// Given
+	record := zephyr.Record{
+		EventID:        "1",
+		EventName:      zephyr.Modify,
+		EventSourceARN: "arn:aws:dynamodb:us-west-2:123456789012:table/orders/stream/2016-01-01T00:00:00.000",
+		Dynamodb: zephyr.StreamRecord{
+			Keys:     map[string]zephyr.AttributeValue{"id": {S: aws.String("abc")}},
+			OldImage: map[string]zephyr.AttributeValue{"id": {S: aws.String("abc")}, "total": {N: aws.String("1")}},
+			NewImage: map[string]zephyr.AttributeValue{"id": {S: aws.String("abc")}, "total": {N: aws.String("2")}},
+		},
+	}
+
+	// When
+	message, err := zephyr.DiffExtractor{}.ExtractMessage(record)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	expected := `{"eventID":"1","eventName":"MODIFY","tableName":"orders","keys":{"id":"abc"},"changes":[{"path":"total","op":"modified","old":1,"new":2}]}`
+	if message != expected {
+		t.Errorf("expected %v; got %v", expected, message)
+	}
+
+	// When
+	message, err = zephyr.DiffExtractor{IncludeNewImage: true}.ExtractMessage(record)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	var v struct {
+		NewImage map[string]interface{} `json:"newImage"`
+	}
+	if err := json.Unmarshal([]byte(message), &v); err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if v.NewImage["total"] != float64(2) {
+		t.Errorf("expected new image total 2; got %v", v.NewImage)
+	}
+}
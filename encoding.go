@@ -0,0 +1,58 @@
+package zephyr
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// ErrNoEncoder is returned by EncodedMessageExtractor when it has no MessageEncoder
+var ErrNoEncoder = errors.New("zephyr:err:no_encoder")
+
+// MessageEncoder encodes records in a binary format.  Messages are published base64
+// encoded, since SNS bodies must be text, with a contentType message attribute so
+// consumers can negotiate the format.
+type MessageEncoder interface {
+	ContentType() string
+	EncodeRecord(record Record) ([]byte, error)
+}
+
+// EncodedMessageExtractor adapts a MessageEncoder to a MessageExtractor
+type EncodedMessageExtractor struct {
+	Encoder MessageEncoder
+}
+
+func (e EncodedMessageExtractor) ExtractMessage(record Record) (string, error) {
+	if e.Encoder == nil {
+		return "", ErrNoEncoder
+	}
+
+	data, err := e.Encoder.EncodeRecord(record)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// messageEncoder returns the MessageEncoder behind the extractor in use, if any
+func (h *Handler) messageEncoder() (MessageEncoder, bool) {
+	var v interface{} = h.extractor
+	if e, ok := v.(messageExtractorContext); ok {
+		v = e.MessageExtractor
+	}
+
+	var encoder MessageEncoder
+	switch e := v.(type) {
+	case EncodedMessageExtractor:
+		encoder = e.Encoder
+	case *EncodedMessageExtractor:
+		if e != nil {
+			encoder = e.Encoder
+		}
+	}
+	return encoder, encoder != nil
+}
+
+// DecodeMessage reverses the base64 encoding of an encoded message body
+func DecodeMessage(body string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(body)
+}
@@ -0,0 +1,262 @@
+package zephyr_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zap"
+	"github.com/savaki/zephyr"
+)
+
+func TestMessageEncoders(t *testing.T) {
+	record := zephyr.Record{
+		EventID: "a",
+		Dynamodb: zephyr.StreamRecord{
+			Keys: map[string]zephyr.AttributeValue{"id": {S: aws.String("1")}},
+		},
+	}
+
+	testCases := map[string]struct {
+		Encoder  zephyr.MessageEncoder
+		Expected string
+	}{
+		"protobuf": {
+			Encoder:  zephyr.ProtobufEncoder{},
+			Expected: "120b" + "0a09" + "0a026964" + "1203" + "0a0131" + "1a0161",
+		},
+		"avro": {
+			Encoder: zephyr.AvroEncoder{},
+			Expected: "c301" + "dc346c29af0530a8" + // single object marker and schema fingerprint
+				"00" + "0000000000000000" + // awsRegion, ApproximateCreationDateTime
+				"02" + "046964" + "0000000000000000" + "020231" + "00" + "00" + // Keys
+				"00" + "00" + "00" + "00" + "00" + // NewImage, OldImage, SequenceNumber, SizeBytes, StreamViewType
+				"0261" + "00" + "00" + "00" + "00", // eventID, eventName, eventSource, eventSourceARN, eventVersion
+		},
+	}
+
+	for label, tc := range testCases {
+		data, err := tc.Encoder.EncodeRecord(record)
+		if err != nil {
+			t.Errorf("%v: expected nil error; got %v", label, err)
+		}
+		if actual := hex.EncodeToString(data); actual != tc.Expected {
+			t.Errorf("%v: expected %v; got %v", label, tc.Expected, actual)
+		}
+	}
+}
+
+func TestAvroSchemaFingerprint(t *testing.T) {
+	if expected := uint64(0xa83005af296c34dc); zephyr.AvroSchemaFingerprint != expected {
+		t.Errorf("expected %x; got %x", expected, zephyr.AvroSchemaFingerprint)
+	}
+}
+
+func TestWithMessageEncoder(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "eventID": "a", "dynamodb": { "Keys": { "id": { "S": "1" } }, "SequenceNumber": "100" } }
+	]
+}`
+
+	var published zephyr.Message
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return "orders", nil
+		}),
+		zephyr.WithMessageEncoder(zephyr.ProtobufEncoder{}),
+		zephyr.WithPublishMessageFunc(func(logger zap.Logger, topicArn *string, message zephyr.Message) error {
+			published = message
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	data, err := zephyr.DecodeMessage(published.Body)
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if expected := "12100a090a02696412030a013122033130301a0161"; hex.EncodeToString(data) != expected {
+		t.Errorf("expected %v; got %x", expected, data)
+	}
+	if v, ok := published.Attributes[zephyr.AttributeContentType]; !ok || *v.StringValue != zephyr.ProtobufContentType {
+		t.Errorf("expected content type attribute %v; got %v", zephyr.ProtobufContentType, published.Attributes)
+	}
+}
+
+func TestMessageEncoderReplacedByLaterExtractor(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "eventID": "a", "dynamodb": { "Keys": { "id": { "S": "1" } }, "SequenceNumber": "100" } }
+	]
+}`
+
+	var published zephyr.Message
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return "orders", nil
+		}),
+		zephyr.WithMessageEncoder(zephyr.ProtobufEncoder{}),
+		zephyr.WithMessageExtractor(zephyr.ExtractMessageFunc(func(record zephyr.Record) (string, error) {
+			return `{"id":"1"}`, nil
+		})),
+		zephyr.WithPublishMessageFunc(func(logger zap.Logger, topicArn *string, message zephyr.Message) error {
+			published = message
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if published.Body != `{"id":"1"}` {
+		t.Errorf("expected extracted message; got %v", published.Body)
+	}
+	if v, ok := published.Attributes[zephyr.AttributeContentType]; ok {
+		t.Errorf("expected no content type attribute; got %v", *v.StringValue)
+	}
+}
+
+func TestMessageEncoderWithCloudEvents(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "eventID": "a", "dynamodb": { "Keys": { "id": { "S": "1" } }, "SequenceNumber": "100" } }
+	]
+}`
+
+	var published zephyr.Message
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return "orders", nil
+		}),
+		zephyr.WithMessageEncoder(zephyr.ProtobufEncoder{}),
+		zephyr.WithCloudEvents(zephyr.CloudEventsOptions{}),
+		zephyr.WithPublishMessageFunc(func(logger zap.Logger, topicArn *string, message zephyr.Message) error {
+			published = message
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	var event zephyr.CloudEvent
+	if err := json.Unmarshal([]byte(published.Body), &event); err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if event.DataContentType != zephyr.ProtobufContentType {
+		t.Errorf("expected %v; got %v", zephyr.ProtobufContentType, event.DataContentType)
+	}
+	if event.Data != nil {
+		t.Errorf("expected no data; got %s", event.Data)
+	}
+	data, err := zephyr.DecodeMessage(event.DataBase64)
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if expected := "12100a090a02696412030a013122033130301a0161"; hex.EncodeToString(data) != expected {
+		t.Errorf("expected %v; got %x", expected, data)
+	}
+	if v, ok := published.Attributes[zephyr.AttributeContentType]; !ok || *v.StringValue != zephyr.CloudEventsContentType {
+		t.Errorf("expected content type attribute %v; got %v", zephyr.CloudEventsContentType, published.Attributes)
+	}
+}
+
+func TestMessageEncoderWithClaimCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zephyr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := zephyr.NewDirBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := `
+{
+	"Records": [
+		{ "eventID": "small", "dynamodb": { "Keys": { "id": { "S": "1" } }, "SequenceNumber": "100" } },
+		{ "eventID": "large", "dynamodb": { "Keys": { "id": { "S": "2" } }, "NewImage": { "text": { "S": "` + strings.Repeat("x", 100) + `" } }, "SequenceNumber": "200" } }
+	]
+}`
+
+	published := map[string]zephyr.Message{}
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return record.EventID, nil
+		}),
+		zephyr.WithMessageEncoder(zephyr.ProtobufEncoder{}),
+		zephyr.WithClaimCheck(store, 100),
+		zephyr.WithPublishMessageFunc(func(logger zap.Logger, topicArn *string, message zephyr.Message) error {
+			published[*topicArn] = message
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	_, err = handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if v, ok := published["small"].Attributes[zephyr.AttributeContentType]; !ok || *v.StringValue != zephyr.ProtobufContentType {
+		t.Errorf("expected content type attribute %v; got %v", zephyr.ProtobufContentType, published["small"].Attributes)
+	}
+
+	large := published["large"]
+	if v, ok := large.Attributes[zephyr.AttributeContentType]; ok {
+		t.Errorf("expected no content type attribute on the claim check; got %v", *v.StringValue)
+	}
+	claimCheck, ok := zephyr.ParseClaimCheck(large.Body)
+	if !ok {
+		t.Fatalf("expected claim check; got %v", large.Body)
+	}
+	if claimCheck.ContentType != zephyr.ProtobufContentType {
+		t.Errorf("expected claim check content type %v; got %v", zephyr.ProtobufContentType, claimCheck.ContentType)
+	}
+}
@@ -0,0 +1,142 @@
+package zephyr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// FIFOSuffix is required at the end of every SNS FIFO topic name
+const FIFOSuffix = ".fifo"
+
+// MessageGroupIDFunc derives the MessageGroupId of a record published to a FIFO topic;
+// messages in the same group are delivered in order
+type MessageGroupIDFunc func(record Record) (string, error)
+
+// DeduplicationIDFunc derives the MessageDeduplicationId of a record published to a
+// FIFO topic
+type DeduplicationIDFunc func(record Record) (string, error)
+
+// KeysGroupID groups messages by item; the id is a hash of the record's Keys since
+// group ids are limited to 128 characters
+func KeysGroupID(record Record) (string, error) {
+	data, err := json.Marshal(record.Dynamodb.Keys)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// EventDeduplicationID uses the stream's EventID, falling back to the SequenceNumber
+func EventDeduplicationID(record Record) (string, error) {
+	if record.EventID != "" {
+		return record.EventID, nil
+	}
+	return record.Dynamodb.SequenceNumber, nil
+}
+
+// fifoTopicName appends FIFOSuffix to topicName when it is not already present
+func fifoTopicName(topicName string) string {
+	if strings.HasSuffix(topicName, FIFOSuffix) {
+		return topicName
+	}
+	return topicName + FIFOSuffix
+}
+
+// fifoIDs assigns the group and deduplication ids to message
+func (h *Handler) fifoIDs(record Record, message *Message) error {
+	groupID, err := h.groupID(record)
+	if err != nil {
+		return err
+	}
+
+	deduplicationID, err := h.deduplicationID(record)
+	if err != nil {
+		return err
+	}
+
+	message.GroupID = groupID
+	message.DeduplicationID = deduplicationID
+	return nil
+}
+
+// ---- SNS ---------------------------------------------------------------------
+
+// the vendored sns package predates FIFO topics; these inputs extend the generated
+// CreateTopicInput and PublishInput with the FIFO fields
+
+type createFIFOTopicInput struct {
+	_ struct{} `type:"structure"`
+
+	Attributes map[string]*string `type:"map"`
+
+	Name *string `type:"string" required:"true"`
+}
+
+type publishFIFOInput struct {
+	_ struct{} `type:"structure"`
+
+	Message *string `type:"string" required:"true"`
+
+	MessageAttributes map[string]*sns.MessageAttributeValue `locationNameKey:"Name" locationNameValue:"Value" type:"map"`
+
+	MessageDeduplicationId *string `type:"string"`
+
+	MessageGroupId *string `type:"string"`
+
+	TopicArn *string `type:"string"`
+}
+
+func createFIFOTopic(client *sns.SNS, topicName string) (*string, error) {
+	op := &request.Operation{
+		Name:       "CreateTopic",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+
+	input := &createFIFOTopicInput{
+		Attributes: map[string]*string{
+			"FifoTopic": aws.String("true"),
+		},
+		Name: aws.String(topicName),
+	}
+
+	output := &sns.CreateTopicOutput{}
+	err := client.NewRequest(op, input, output).Send()
+	if err != nil {
+		return nil, err
+	}
+
+	return output.TopicArn, nil
+}
+
+func publishFIFO(client *sns.SNS, topicArn *string, message Message) error {
+	op := &request.Operation{
+		Name:       "Publish",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+
+	input := &publishFIFOInput{
+		Message:  aws.String(message.Body),
+		TopicArn: topicArn,
+	}
+	if len(message.Attributes) > 0 {
+		input.MessageAttributes = message.Attributes
+	}
+	if message.GroupID != "" {
+		input.MessageGroupId = aws.String(message.GroupID)
+	}
+	if message.DeduplicationID != "" {
+		input.MessageDeduplicationId = aws.String(message.DeduplicationID)
+	}
+
+	return client.NewRequest(op, input, &sns.PublishOutput{}).Send()
+}
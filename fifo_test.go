@@ -0,0 +1,119 @@
+package zephyr
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/savaki/zap"
+)
+
+func TestFIFO(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "eventID": "abc", "dynamodb": { "Keys": { "id": { "S": "123" } }, "SequenceNumber": "100" } }
+	]
+}`
+
+	var topicNames []string
+	var published Message
+
+	// Given
+	handler := New(
+		WithTopicNameFunc(func(record Record) (string, error) {
+			return "orders", nil
+		}),
+		WithPublishMessageFunc(func(logger zap.Logger, topicArn *string, message Message) error {
+			published = message
+			return nil
+		}),
+		WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			topicNames = append(topicNames, topicName)
+			return aws.String(topicName), nil
+		}),
+		WithFIFOTopics(),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if len(topicNames) != 1 || topicNames[0] != "orders.fifo" {
+		t.Errorf("expected [orders.fifo]; got %v", topicNames)
+	}
+	if published.DeduplicationID != "abc" {
+		t.Errorf("expected abc; got %v", published.DeduplicationID)
+	}
+
+	groupID, _ := KeysGroupID(Record{
+		Dynamodb: StreamRecord{
+			Keys: map[string]AttributeValue{"id": {S: aws.String("123")}},
+		},
+	})
+	if published.GroupID != groupID {
+		t.Errorf("expected %v; got %v", groupID, published.GroupID)
+	}
+}
+
+func TestFIFORequests(t *testing.T) {
+	client := sns.New(session.New(&aws.Config{Region: aws.String("us-east-1")}))
+
+	testCases := map[string]struct {
+		Input    interface{}
+		Expected map[string]string
+	}{
+		"create": {
+			Input: &createFIFOTopicInput{
+				Attributes: map[string]*string{"FifoTopic": aws.String("true")},
+				Name:       aws.String("orders.fifo"),
+			},
+			Expected: map[string]string{
+				"Attributes.entry.1.key":   "FifoTopic",
+				"Attributes.entry.1.value": "true",
+				"Name":                     "orders.fifo",
+			},
+		},
+		"publish": {
+			Input: &publishFIFOInput{
+				Message:                aws.String("hello"),
+				MessageGroupId:         aws.String("group"),
+				MessageDeduplicationId: aws.String("dedup"),
+				TopicArn:               aws.String("arn"),
+			},
+			Expected: map[string]string{
+				"Message":                "hello",
+				"MessageGroupId":         "group",
+				"MessageDeduplicationId": "dedup",
+				"TopicArn":               "arn",
+			},
+		},
+	}
+
+	for label, tc := range testCases {
+		req := client.NewRequest(&request.Operation{Name: label, HTTPMethod: "POST", HTTPPath: "/"}, tc.Input, nil)
+		if err := req.Build(); err != nil {
+			t.Fatalf("%v: expected nil error; got %v", label, err)
+		}
+
+		data, _ := ioutil.ReadAll(req.Body)
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			t.Fatalf("%v: expected nil error; got %v", label, err)
+		}
+
+		for k, v := range tc.Expected {
+			if got := values.Get(k); got != v {
+				t.Errorf("%v: expected %v=%v; got %v", label, k, v, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package zephyr
+
+import (
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ---- RecordFilter ------------------------------------------------------------
+
+type FilterRecordFunc func(record Record) bool
+
+func (fn FilterRecordFunc) FilterRecord(record Record) bool {
+	return fn(record)
+}
+
+// RecordFilter decides which records Handler routes; records for which FilterRecord
+// returns false are dropped before their topic is named and counted as filtered
+type RecordFilter interface {
+	FilterRecord(record Record) bool
+}
+
+// EventNames matches records with any of the given event names, e.g. zephyr.Insert
+func EventNames(names ...string) FilterRecordFunc {
+	return func(record Record) bool {
+		for _, name := range names {
+			if record.EventName == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// EventSourceARN matches records whose EventSourceARN matches any of the path.Match
+// patterns, e.g. arn:aws:dynamodb:*:*:table/orders/stream/*
+func EventSourceARN(patterns ...string) FilterRecordFunc {
+	return func(record Record) bool {
+		return matchPatterns(record.EventSourceARN, patterns)
+	}
+}
+
+// TableNames matches records from tables whose name matches any of the path.Match
+// patterns
+func TableNames(patterns ...string) FilterRecordFunc {
+	return func(record Record) bool {
+		tableName, ok := TableName(record)
+		return ok && matchPatterns(tableName, patterns)
+	}
+}
+
+// AttributeExists matches records whose image has an attribute at path.  See
+// LookupAttribute for the path syntax and RecordImage for which image is consulted.
+func AttributeExists(path string) FilterRecordFunc {
+	return func(record Record) bool {
+		_, ok := LookupAttribute(RecordImage(record), path)
+		return ok
+	}
+}
+
+// AttributeEquals matches records whose image has an attribute at path equal to value.
+// value is converted as MarshalImage would, so numbers compare numerically; a nil value
+// matches NULL attributes.
+func AttributeEquals(path string, value interface{}) FilterRecordFunc {
+	want := AttributeValue{NULL: boolPtr(true)}
+	if value != nil {
+		av, err := marshalValue(reflect.ValueOf(value), "")
+		if err != nil {
+			return func(Record) bool { return false }
+		}
+		want = av
+	}
+
+	return func(record Record) bool {
+		av, ok := LookupAttribute(RecordImage(record), path)
+		return ok && equalValues(av, want)
+	}
+}
+
+// And matches records that match every filter
+func And(filters ...RecordFilter) FilterRecordFunc {
+	return func(record Record) bool {
+		for _, filter := range filters {
+			if !filter.FilterRecord(record) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches records that match any filter
+func Or(filters ...RecordFilter) FilterRecordFunc {
+	return func(record Record) bool {
+		for _, filter := range filters {
+			if filter.FilterRecord(record) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches records that filter does not
+func Not(filter RecordFilter) FilterRecordFunc {
+	return func(record Record) bool {
+		return !filter.FilterRecord(record)
+	}
+}
+
+// RecordImage returns the NewImage, or the OldImage for records without one such as
+// REMOVE events
+func RecordImage(record Record) map[string]AttributeValue {
+	if len(record.Dynamodb.NewImage) > 0 {
+		return record.Dynamodb.NewImage
+	}
+	return record.Dynamodb.OldImage
+}
+
+// LookupAttribute returns the value at path.  This is the attribute path syntax used
+// throughout zephyr, by the filters, transforms, ChangedTopicNamer and Change.Path: map
+// keys are separated by dots and list elements are indexed either with brackets or as
+// another segment, so items[0].sku and items.0.sku name the same attribute.
+func LookupAttribute(item map[string]AttributeValue, path string) (AttributeValue, bool) {
+	segments := splitPath(path)
+
+	av, ok := item[segments[0]]
+	for _, segment := range segments[1:] {
+		if !ok {
+			break
+		}
+
+		switch {
+		case av.M != nil:
+			av, ok = av.M[segment]
+		case av.L != nil:
+			index, err := strconv.Atoi(segment)
+			ok = err == nil && index >= 0 && index < len(av.L)
+			if ok {
+				av = av.L[index]
+			}
+		default:
+			ok = false
+		}
+	}
+
+	if !ok {
+		return AttributeValue{}, false
+	}
+	return av, true
+}
+
+var pathReplacer = strings.NewReplacer("[", ".", "]", "")
+
+// splitPath returns the map keys and list indexes of an attribute path
+func splitPath(path string) []string {
+	return strings.Split(pathReplacer.Replace(path), ".")
+}
+
+func matchPatterns(s string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
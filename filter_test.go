@@ -0,0 +1,112 @@
+package zephyr_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zap"
+	"github.com/savaki/zephyr"
+)
+
+func TestRecordFilters(t *testing.T) {
+	record := zephyr.Record{
+		EventName:      zephyr.Modify,
+		EventSourceARN: "arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/2016-05-16T22:22:50.550",
+		Dynamodb: zephyr.StreamRecord{
+			NewImage: map[string]zephyr.AttributeValue{
+				"total":   {N: aws.String("10.0")},
+				"source":  {S: aws.String("backfill")},
+				"deleted": {NULL: aws.Bool(true)},
+				"user": {M: map[string]zephyr.AttributeValue{
+					"emails": {L: []zephyr.AttributeValue{{S: aws.String("test@example.com")}}},
+				}},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		Filter   zephyr.RecordFilter
+		Expected bool
+	}{
+		"event name":               {Filter: zephyr.EventNames(zephyr.Insert, zephyr.Modify), Expected: true},
+		"other event name":         {Filter: zephyr.EventNames(zephyr.Remove), Expected: false},
+		"event source arn":         {Filter: zephyr.EventSourceARN("arn:aws:dynamodb:*:*:table/orders/stream/*"), Expected: true},
+		"other event source arn":   {Filter: zephyr.EventSourceARN("arn:aws:dynamodb:*:*:table/users/stream/*"), Expected: false},
+		"table name":               {Filter: zephyr.TableNames("test-*", "ord*"), Expected: true},
+		"attribute exists":         {Filter: zephyr.AttributeExists("user.emails.0"), Expected: true},
+		"attribute missing":        {Filter: zephyr.AttributeExists("user.emails.1"), Expected: false},
+		"attribute exists bracket": {Filter: zephyr.AttributeExists("user.emails[0]"), Expected: true},
+		"attribute equals string":  {Filter: zephyr.AttributeEquals("user.emails.0", "test@example.com"), Expected: true},
+		"attribute equals number":  {Filter: zephyr.AttributeEquals("total", 10), Expected: true},
+		"attribute equals nil":     {Filter: zephyr.AttributeEquals("deleted", nil), Expected: true},
+		"attribute not equal":      {Filter: zephyr.AttributeEquals("source", "api"), Expected: false},
+		"and": {
+			Filter:   zephyr.And(zephyr.EventNames(zephyr.Modify), zephyr.AttributeEquals("source", "backfill")),
+			Expected: true,
+		},
+		"or": {
+			Filter:   zephyr.Or(zephyr.EventNames(zephyr.Insert), zephyr.TableNames("users")),
+			Expected: false,
+		},
+		"not": {
+			Filter:   zephyr.Not(zephyr.AttributeEquals("source", "backfill")),
+			Expected: false,
+		},
+	}
+
+	for label, tc := range testCases {
+		if actual := tc.Filter.FilterRecord(record); actual != tc.Expected {
+			t.Errorf("%v: expected %v; got %v", label, tc.Expected, actual)
+		}
+	}
+}
+
+func TestWithRecordFilter(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "eventName": "INSERT", "dynamodb": { "SequenceNumber": "100", "NewImage": { "source": { "S": "api" } } } },
+		{ "eventName": "INSERT", "dynamodb": { "SequenceNumber": "101", "NewImage": { "source": { "S": "backfill" } } } },
+		{ "eventName": "REMOVE", "dynamodb": { "SequenceNumber": "102" } }
+	]
+}`
+
+	w := &bytes.Buffer{}
+	published := 0
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithRecordFilter(zephyr.And(
+			zephyr.EventNames(zephyr.Insert),
+			zephyr.Not(zephyr.AttributeEquals("source", "backfill")),
+		)),
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return "orders", nil
+		}),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			published++
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+		zephyr.Output(w),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if published != 1 {
+		t.Errorf("expected 1 message published; got %v", published)
+	}
+	if !strings.Contains(w.String(), `"filtered":2`) {
+		t.Errorf("expected 2 filtered records to be logged; got %v", w.String())
+	}
+}
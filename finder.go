@@ -0,0 +1,123 @@
+package zephyr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+var (
+	// ErrTopicNotFound is returned by the strict TopicArnFinders for topics that do not exist
+	ErrTopicNotFound = errors.New("zephyr:err:topic_not_found")
+)
+
+// UnknownTopicPolicy determines what happens to records whose topic does not exist
+type UnknownTopicPolicy int
+
+const (
+	// UnknownTopicError fails the record so it is retried
+	UnknownTopicError UnknownTopicPolicy = iota
+
+	// UnknownTopicDeadLetter sends the record to the DeadLetterSink
+	UnknownTopicDeadLetter
+
+	// UnknownTopicFallback publishes the record to the fallback topic instead
+	UnknownTopicFallback
+)
+
+// DefaultTopicRefresh is the minimum interval between ListTopics scans
+const DefaultTopicRefresh = time.Minute
+
+// isTopicNotFound reports whether err indicates the topic does not exist, either from a
+// strict TopicArnFinder or from SNS itself
+func isTopicNotFound(err error) bool {
+	return err == ErrTopicNotFound || ErrCode(err) == "NotFound"
+}
+
+// topicNameFromArn returns the topic name, the last segment of arn:aws:sns:region:account:name
+func topicNameFromArn(topicArn string) string {
+	return topicArn[strings.LastIndex(topicArn, ":")+1:]
+}
+
+// ---- Account -----------------------------------------------------------------
+
+// NewAccountTopicArnFinder constructs topic arns from the region and account without
+// calling SNS; publishing to a topic that does not exist fails with NotFound
+func NewAccountTopicArnFinder(region, accountID string) FindTopicArnFunc {
+	return func(topicName string) (*string, error) {
+		topicArn := fmt.Sprintf("arn:aws:sns:%v:%v:%v", region, accountID, topicName)
+		return &topicArn, nil
+	}
+}
+
+// ---- ListTopics --------------------------------------------------------------
+
+// ListTopicsArnFinder resolves topic arns from an index of the account's existing topics.
+// The index is rebuilt on a miss, at most once per Refresh; topics that are still absent
+// return ErrTopicNotFound.
+type ListTopicsArnFinder struct {
+	Refresh time.Duration
+
+	list      func() (map[string]*string, error)
+	now       func() time.Time
+	mux       *sync.Mutex
+	topics    map[string]*string
+	refreshed time.Time
+}
+
+func (f *ListTopicsArnFinder) FindTopicArn(topicName string) (*string, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if topicArn, ok := f.topics[topicName]; ok {
+		return topicArn, nil
+	}
+
+	if f.topics != nil && f.now().Sub(f.refreshed) < f.Refresh {
+		return nil, ErrTopicNotFound
+	}
+
+	topics, err := f.list()
+	if err != nil {
+		return nil, err
+	}
+	f.topics = topics
+	f.refreshed = f.now()
+
+	if topicArn, ok := f.topics[topicName]; ok {
+		return topicArn, nil
+	}
+
+	return nil, ErrTopicNotFound
+}
+
+func NewListTopicsArnFinder(refresh time.Duration) *ListTopicsArnFinder {
+	client := sns.New(session.New(awsConfig()))
+
+	if refresh <= 0 {
+		refresh = DefaultTopicRefresh
+	}
+
+	return &ListTopicsArnFinder{
+		Refresh: refresh,
+		list: func() (map[string]*string, error) {
+			topics := map[string]*string{}
+			err := client.ListTopicsPages(&sns.ListTopicsInput{}, func(page *sns.ListTopicsOutput, lastPage bool) bool {
+				for _, topic := range page.Topics {
+					if topic.TopicArn != nil {
+						topics[topicNameFromArn(*topic.TopicArn)] = topic.TopicArn
+					}
+				}
+				return true
+			})
+			return topics, err
+		},
+		now: time.Now,
+		mux: &sync.Mutex{},
+	}
+}
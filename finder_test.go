@@ -0,0 +1,45 @@
+package zephyr
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListTopicsArnFinder(t *testing.T) {
+	now := time.Now()
+	topicArn := "arn:aws:sns:us-east-1:123456789012:orders"
+
+	var lists int
+	f := &ListTopicsArnFinder{
+		Refresh: time.Minute,
+		list: func() (map[string]*string, error) {
+			lists++
+			return map[string]*string{
+				topicNameFromArn(topicArn): &topicArn,
+			}, nil
+		},
+		now: func() time.Time { return now },
+		mux: &sync.Mutex{},
+	}
+
+	v, err := f.FindTopicArn("orders")
+	if err != nil || *v != topicArn {
+		t.Errorf("expected %v; got %v, %v", topicArn, v, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := f.FindTopicArn("unknown"); err != ErrTopicNotFound {
+			t.Errorf("expected ErrTopicNotFound; got %v", err)
+		}
+	}
+	if lists != 1 {
+		t.Errorf("expected 1 list; got %v", lists)
+	}
+
+	now = now.Add(time.Minute)
+	f.FindTopicArn("unknown")
+	if lists != 2 {
+		t.Errorf("expected 2 lists; got %v", lists)
+	}
+}
@@ -20,6 +20,8 @@ func main() {
 
 	z := zephyr.New(
 		zephyr.WithHandler(handler),
+		zephyr.WithTimeoutFromEnv(0),
+		zephyr.WithPartialBatchResponse(),
 		zephyr.Output(w),
 	)
 
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/apex/go-apex"
+	"github.com/savaki/loggly"
+	"github.com/savaki/zap"
+	"github.com/savaki/zephyr"
+	"github.com/savaki/zephyr/rules"
+)
+
+func main() {
+	var w zap.WriteSyncer = os.Stderr
+	if token := os.Getenv("LOGGLY_TOKEN"); token != "" {
+		client := loggly.New(token)
+		w = zap.AddSync(client)
+	}
+
+	filename := os.Getenv("RULES_FILE")
+	if filename == "" {
+		filename = "rules.json"
+	}
+
+	router, err := rules.Load(filename)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	z := zephyr.New(
+		zephyr.WithHandler(router),
+		zephyr.WithTimeoutFromEnv(0),
+		zephyr.WithPartialBatchResponse(),
+		zephyr.Output(w),
+	)
+
+	apex.HandleFunc(z)
+}
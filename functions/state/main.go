@@ -19,6 +19,8 @@ func main() {
 
 	z := zephyr.New(
 		zephyr.WithHandler(topicbystate.New("state")),
+		zephyr.WithTimeoutFromEnv(0),
+		zephyr.WithPartialBatchResponse(),
 		zephyr.Output(w),
 	)
 
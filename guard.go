@@ -0,0 +1,89 @@
+package zephyr
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/savaki/zap"
+	"golang.org/x/net/context"
+)
+
+var (
+	// ErrTopicDenied is returned when a TopicGuard refuses a topic
+	ErrTopicDenied = errors.New("zephyr:err:topic_denied")
+)
+
+// TopicGuard limits the topics zephyr will publish to, protecting against routers that
+// derive topic names from arbitrary attribute values
+type TopicGuard struct {
+	// Allow lists the permitted topic names; entries may be path.Match patterns such as
+	// orders-*.  An empty Allow permits every name.  When WithFIFOTopics is used, names
+	// are matched before the .fifo suffix is added.
+	Allow []string
+
+	// MaxTopicLookups caps the topic arns looked up, rather than served from the cache, per
+	// invocation; 0 is unlimited.  The default TopicArnFinder creates the topic on lookup, so
+	// this bounds the topics a single invocation can create.  Records over the cap fail and
+	// are retried.
+	MaxTopicLookups int
+}
+
+// Allowed reports whether topicName matches the allowlist
+func (g TopicGuard) Allowed(topicName string) bool {
+	if len(g.Allow) == 0 {
+		return true
+	}
+
+	for _, pattern := range g.Allow {
+		if pattern == topicName {
+			return true
+		}
+		if ok, _ := path.Match(pattern, topicName); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowedTopics removes, and logs, the topic names the guard does not allow
+func (h *Handler) allowedTopics(logger zap.Logger, topicNames []string) []string {
+	if h.guard == nil {
+		return topicNames
+	}
+
+	allowed := topicNames[:0]
+	for _, topicName := range topicNames {
+		name := topicName
+		if h.fifo {
+			name = strings.TrimSuffix(topicName, FIFOSuffix)
+		}
+		if !h.guard.Allowed(name) {
+			logger.Warn("zephyr:err:topic_denied", zap.String("name", topicName), zap.String("reason", "not_allowed"))
+			continue
+		}
+		allowed = append(allowed, topicName)
+	}
+
+	return allowed
+}
+
+// guardedTopicArnFinder enforces TopicGuard.MaxTopicLookups; it wraps the finder the
+// topic arn cache calls on a miss, so only lookups are counted
+type guardedTopicArnFinder struct {
+	max    int64
+	count  *int64
+	target TopicArnFinderContext
+	log    zap.Logger
+}
+
+func (g *guardedTopicArnFinder) FindTopicArnContext(ctx context.Context, topicName string) (*string, error) {
+	if n := atomic.AddInt64(g.count, 1); n > g.max {
+		g.log.Warn("zephyr:err:topic_denied", zap.String("name", topicName), zap.String("reason", "quota"))
+		return nil, ErrTopicDenied
+	}
+
+	return g.target.FindTopicArnContext(ctx, topicName)
+}
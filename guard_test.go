@@ -0,0 +1,125 @@
+package zephyr_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zap"
+	"github.com/savaki/zephyr"
+)
+
+func TestTopicGuardAllowed(t *testing.T) {
+	guard := zephyr.TopicGuard{
+		Allow: []string{"audit", "orders-*"},
+	}
+
+	for topicName, expected := range map[string]bool{
+		"audit":        true,
+		"orders-open":  true,
+		"orders":       false,
+		"users-active": false,
+	} {
+		if v := guard.Allowed(topicName); v != expected {
+			t.Errorf("%v: expected %v; got %v", topicName, expected, v)
+		}
+	}
+}
+
+func TestTopicGuard(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "eventID": "orders-a",  "dynamodb": { "Keys": { "id": { "S": "1" } }, "SequenceNumber": "100" } },
+		{ "eventID": "users-a",   "dynamodb": { "Keys": { "id": { "S": "2" } }, "SequenceNumber": "200" } },
+		{ "eventID": "orders-b",  "dynamodb": { "Keys": { "id": { "S": "3" } }, "SequenceNumber": "300" } },
+		{ "eventID": "orders-c",  "dynamodb": { "Keys": { "id": { "S": "4" } }, "SequenceNumber": "400" } },
+		{ "eventID": "orders-a",  "dynamodb": { "Keys": { "id": { "S": "5" } }, "SequenceNumber": "500" } }
+	]
+}`
+
+	w := &bytes.Buffer{}
+	var published []string
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithPartialBatchResponse(),
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return record.EventID, nil
+		}),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			published = append(published, *topicArn)
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+		zephyr.WithTopicGuard(zephyr.TopicGuard{
+			Allow:           []string{"orders-*"},
+			MaxTopicLookups: 2,
+		}),
+		zephyr.Output(w),
+	)
+
+	// When
+	v, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if expected := "orders-a,orders-b,orders-a"; strings.Join(published, ",") != expected {
+		t.Errorf("expected %v; got %v", expected, published)
+	}
+
+	failures := v.(*zephyr.BatchResponse).BatchItemFailures
+	if len(failures) != 1 || failures[0].ItemIdentifier != "400" {
+		t.Errorf("expected sequence 400 to fail; got %v", failures)
+	}
+	if n := strings.Count(w.String(), `"msg":"zephyr:err:topic_denied"`); n != 2 {
+		t.Errorf("expected 2 topic_denied log events; got %v", n)
+	}
+}
+
+func TestTopicGuardFIFOTopics(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "eventID": "orders",  "dynamodb": { "Keys": { "id": { "S": "1" } }, "SequenceNumber": "100" } },
+		{ "eventID": "users",   "dynamodb": { "Keys": { "id": { "S": "2" } }, "SequenceNumber": "200" } }
+	]
+}`
+
+	var published []string
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return record.EventID, nil
+		}),
+		zephyr.WithFIFOTopics(),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			published = append(published, *topicArn)
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+		zephyr.WithTopicGuard(zephyr.TopicGuard{
+			Allow: []string{"orders"},
+		}),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if expected := "orders.fifo"; strings.Join(published, ",") != expected {
+		t.Errorf("expected %v; got %v", expected, published)
+	}
+}
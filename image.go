@@ -0,0 +1,554 @@
+package zephyr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidUnmarshal is returned when UnmarshalImage is not given a non-nil pointer
+	ErrInvalidUnmarshal = errors.New("zephyr:err:invalid_unmarshal")
+
+	// ErrInvalidMarshal is returned when MarshalImage is given something other than a
+	// struct or a map with string keys
+	ErrInvalidMarshal = errors.New("zephyr:err:invalid_marshal")
+)
+
+var (
+	byteSliceType  = reflect.TypeOf([]byte(nil))
+	numberType     = reflect.TypeOf(json.Number(""))
+	timeType       = reflect.TypeOf(time.Time{})
+	emptyInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// field is a struct field as named by its dynamodbav or json tag; dynamodbav wins.
+// Tag options are omitempty, and stringset, numberset or binaryset to encode a slice as
+// an SS, NS or BS rather than an L.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	set       string
+}
+
+func fields(t reflect.Type) []field {
+	var fs []field
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag := sf.Tag.Get("dynamodbav")
+		if tag == "" {
+			tag = sf.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+
+		options := strings.Split(tag, ",")
+		name := options[0]
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for _, embedded := range fields(ft) {
+					embedded.index = append([]int{i}, embedded.index...)
+					fs = append(fs, embedded)
+				}
+				continue
+			}
+		}
+
+		if sf.PkgPath != "" { // unexported
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		f := field{name: name, index: []int{i}}
+		for _, option := range options[1:] {
+			switch option {
+			case "omitempty":
+				f.omitEmpty = true
+			case "stringset", "numberset", "binaryset":
+				f.set = option
+			}
+		}
+		fs = append(fs, f)
+	}
+
+	return fs
+}
+
+// ---- Marshal -----------------------------------------------------------------
+
+// MarshalImage converts a struct, or a map with string keys, into a DynamoDB image
+func MarshalImage(v interface{}) (map[string]AttributeValue, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, ErrInvalidMarshal
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct && (rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String) {
+		return nil, ErrInvalidMarshal
+	}
+
+	av, err := marshalValue(rv, "")
+	if err != nil {
+		return nil, err
+	}
+	return av.M, nil
+}
+
+func marshalValue(rv reflect.Value, set string) (AttributeValue, error) {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return AttributeValue{NULL: boolPtr(true)}, nil
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Type() {
+	case numberType:
+		return AttributeValue{N: strPtr(rv.String())}, nil
+	case timeType:
+		return AttributeValue{S: strPtr(rv.Interface().(time.Time).Format(time.RFC3339Nano))}, nil
+	case byteSliceType:
+		if rv.IsNil() {
+			return AttributeValue{NULL: boolPtr(true)}, nil
+		}
+		return AttributeValue{B: rv.Bytes()}, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return AttributeValue{S: strPtr(rv.String())}, nil
+
+	case reflect.Bool:
+		return AttributeValue{BOOL: boolPtr(rv.Bool())}, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return AttributeValue{N: strPtr(formatNumber(rv))}, nil
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return AttributeValue{NULL: boolPtr(true)}, nil
+		}
+		if set != "" {
+			return marshalSet(rv, set)
+		}
+
+		list := make([]AttributeValue, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			av, err := marshalValue(rv.Index(i), "")
+			if err != nil {
+				return AttributeValue{}, err
+			}
+			list[i] = av
+		}
+		return AttributeValue{L: list}, nil
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return AttributeValue{}, fmt.Errorf("zephyr: cannot marshal map with %v keys", rv.Type().Key())
+		}
+		if rv.IsNil() {
+			return AttributeValue{NULL: boolPtr(true)}, nil
+		}
+
+		m := make(map[string]AttributeValue, rv.Len())
+		for _, key := range rv.MapKeys() {
+			av, err := marshalValue(rv.MapIndex(key), "")
+			if err != nil {
+				return AttributeValue{}, err
+			}
+			m[key.String()] = av
+		}
+		return AttributeValue{M: m}, nil
+
+	case reflect.Struct:
+		m := map[string]AttributeValue{}
+		for _, f := range fields(rv.Type()) {
+			fv, ok := fieldByIndex(rv, f.index, false)
+			if !ok || (f.omitEmpty && isEmpty(fv)) {
+				continue
+			}
+
+			av, err := marshalValue(fv, f.set)
+			if err != nil {
+				return AttributeValue{}, err
+			}
+			m[f.name] = av
+		}
+		return AttributeValue{M: m}, nil
+
+	default:
+		return AttributeValue{}, fmt.Errorf("zephyr: cannot marshal %v", rv.Type())
+	}
+}
+
+func marshalSet(rv reflect.Value, set string) (AttributeValue, error) {
+	switch set {
+	case "binaryset":
+		bs := make([][]byte, rv.Len())
+		for i := range bs {
+			item := reflect.Indirect(rv.Index(i))
+			if item.Type() != byteSliceType {
+				return AttributeValue{}, fmt.Errorf("zephyr: cannot marshal %v as a binaryset", rv.Type())
+			}
+			bs[i] = item.Bytes()
+		}
+		return AttributeValue{BS: bs}, nil
+
+	default:
+		values := make([]*string, rv.Len())
+		for i := range values {
+			av, err := marshalValue(rv.Index(i), "")
+			if err != nil {
+				return AttributeValue{}, err
+			}
+			switch {
+			case set == "stringset" && av.S != nil:
+				values[i] = av.S
+			case set == "numberset" && av.N != nil:
+				values[i] = av.N
+			default:
+				return AttributeValue{}, fmt.Errorf("zephyr: cannot marshal %v as a %v", rv.Type(), set)
+			}
+		}
+		if set == "stringset" {
+			return AttributeValue{SS: values}, nil
+		}
+		return AttributeValue{NS: values}, nil
+	}
+}
+
+func formatNumber(rv reflect.Value) string {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64)
+	default:
+		return strconv.FormatUint(rv.Uint(), 10)
+	}
+}
+
+func isEmpty(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// fieldByIndex walks embedded structs; when alloc is set nil embedded pointers are
+// allocated, otherwise ok is false.  ok is also false when a nil embedded pointer can't
+// be allocated because its field is unexported, as encoding/json reports.
+func fieldByIndex(rv reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				if !alloc || !rv.CanSet() {
+					return reflect.Value{}, false
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, true
+}
+
+func strPtr(v string) *string { return &v }
+
+func boolPtr(v bool) *bool { return &v }
+
+// ---- Unmarshal ---------------------------------------------------------------
+
+// UnmarshalImage stores a DynamoDB image in v, a pointer to a struct or map.  Values
+// decoded into an interface{} take the types PlainValue returns, except that binary
+// values remain []byte.
+func UnmarshalImage(item map[string]AttributeValue, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrInvalidUnmarshal
+	}
+
+	return unmarshalValue(AttributeValue{M: item}, rv.Elem())
+}
+
+func unmarshalValue(av AttributeValue, rv reflect.Value) error {
+	if av.NULL != nil || isZeroAttributeValue(av) {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return unmarshalValue(av, rv.Elem())
+	}
+
+	if rv.Kind() == reflect.Interface {
+		if rv.NumMethod() != 0 {
+			return unmarshalError(av, rv.Type())
+		}
+		rv.Set(reflect.ValueOf(interfaceValue(av)))
+		return nil
+	}
+
+	switch rv.Type() {
+	case numberType:
+		if av.N == nil {
+			return unmarshalError(av, rv.Type())
+		}
+		rv.SetString(*av.N)
+		return nil
+
+	case timeType:
+		if av.S == nil {
+			return unmarshalError(av, rv.Type())
+		}
+		t, err := time.Parse(time.RFC3339Nano, *av.S)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(t))
+		return nil
+
+	case byteSliceType:
+		if av.B == nil {
+			return unmarshalError(av, rv.Type())
+		}
+		rv.SetBytes(av.B)
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		switch {
+		case av.S != nil:
+			rv.SetString(*av.S)
+		case av.N != nil:
+			rv.SetString(*av.N)
+		default:
+			return unmarshalError(av, rv.Type())
+		}
+
+	case reflect.Bool:
+		if av.BOOL == nil {
+			return unmarshalError(av, rv.Type())
+		}
+		rv.SetBool(*av.BOOL)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if av.N == nil {
+			return unmarshalError(av, rv.Type())
+		}
+		n, err := strconv.ParseInt(*av.N, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if av.N == nil {
+			return unmarshalError(av, rv.Type())
+		}
+		n, err := strconv.ParseUint(*av.N, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		if av.N == nil {
+			return unmarshalError(av, rv.Type())
+		}
+		n, err := strconv.ParseFloat(*av.N, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(n)
+
+	case reflect.Slice, reflect.Array:
+		items, ok := listItems(av)
+		if !ok {
+			return unmarshalError(av, rv.Type())
+		}
+
+		if rv.Kind() == reflect.Slice {
+			rv.Set(reflect.MakeSlice(rv.Type(), len(items), len(items)))
+		} else if len(items) > rv.Len() {
+			return fmt.Errorf("zephyr: cannot unmarshal %v items into %v", len(items), rv.Type())
+		}
+
+		for i, item := range items {
+			if err := unmarshalValue(item, rv.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if av.M == nil || rv.Type().Key().Kind() != reflect.String {
+			return unmarshalError(av, rv.Type())
+		}
+
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		for key, item := range av.M {
+			ev := reflect.New(rv.Type().Elem()).Elem()
+			if err := unmarshalValue(item, ev); err != nil {
+				return err
+			}
+			rv.SetMapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()), ev)
+		}
+
+	case reflect.Struct:
+		if av.M == nil {
+			return unmarshalError(av, rv.Type())
+		}
+
+		for _, f := range fields(rv.Type()) {
+			item, ok := av.M[f.name]
+			if !ok {
+				continue
+			}
+
+			fv, ok := fieldByIndex(rv, f.index, true)
+			if !ok {
+				return fmt.Errorf("%v: zephyr: cannot set embedded pointer to unexported struct in %v", f.name, rv.Type())
+			}
+			if err := unmarshalValue(item, fv); err != nil {
+				return fmt.Errorf("%v: %v", f.name, err)
+			}
+		}
+
+	default:
+		return unmarshalError(av, rv.Type())
+	}
+
+	return nil
+}
+
+// listItems returns the elements of an L, SS, NS or BS as AttributeValues
+func listItems(av AttributeValue) ([]AttributeValue, bool) {
+	switch {
+	case av.L != nil:
+		return av.L, true
+	case av.SS != nil:
+		items := make([]AttributeValue, len(av.SS))
+		for i, s := range av.SS {
+			items[i] = AttributeValue{S: s}
+		}
+		return items, true
+	case av.NS != nil:
+		items := make([]AttributeValue, len(av.NS))
+		for i, n := range av.NS {
+			items[i] = AttributeValue{N: n}
+		}
+		return items, true
+	case av.BS != nil:
+		items := make([]AttributeValue, len(av.BS))
+		for i, b := range av.BS {
+			items[i] = AttributeValue{B: b}
+		}
+		return items, true
+	default:
+		return nil, false
+	}
+}
+
+func interfaceValue(av AttributeValue) interface{} {
+	switch {
+	case av.B != nil:
+		return av.B
+	case av.BS != nil:
+		list := make([]interface{}, len(av.BS))
+		for i, b := range av.BS {
+			list[i] = b
+		}
+		return list
+	case av.M != nil:
+		m := make(map[string]interface{}, len(av.M))
+		for k, item := range av.M {
+			m[k] = interfaceValue(item)
+		}
+		return m
+	case av.L != nil:
+		list := make([]interface{}, len(av.L))
+		for i, item := range av.L {
+			list[i] = interfaceValue(item)
+		}
+		return list
+	default:
+		return PlainValue(av)
+	}
+}
+
+func isZeroAttributeValue(av AttributeValue) bool {
+	return av.B == nil && av.BOOL == nil && av.BS == nil && av.L == nil && av.M == nil &&
+		av.N == nil && av.NS == nil && av.S == nil && av.SS == nil
+}
+
+func unmarshalError(av AttributeValue, t reflect.Type) error {
+	return fmt.Errorf("zephyr: cannot unmarshal %v into %v", attributeKind(av), t)
+}
+
+func attributeKind(av AttributeValue) string {
+	switch {
+	case av.S != nil:
+		return "S"
+	case av.N != nil:
+		return "N"
+	case av.B != nil:
+		return "B"
+	case av.BOOL != nil:
+		return "BOOL"
+	case av.NULL != nil:
+		return "NULL"
+	case av.M != nil:
+		return "M"
+	case av.L != nil:
+		return "L"
+	case av.SS != nil:
+		return "SS"
+	case av.NS != nil:
+		return "NS"
+	case av.BS != nil:
+		return "BS"
+	default:
+		return "empty"
+	}
+}
@@ -0,0 +1,237 @@
+package zephyr_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zephyr"
+)
+
+type Audit struct {
+	CreatedBy string `json:"createdBy"`
+}
+
+type Line struct {
+	SKU      string  `dynamodbav:"sku"`
+	Quantity int     `dynamodbav:"qty"`
+	Price    float64 `dynamodbav:"price"`
+}
+
+type Order struct {
+	Audit
+	ID       string            `dynamodbav:"id" json:"orderId"`
+	Total    int64             `json:"total"`
+	Discount float32           `json:"discount"`
+	Count    uint16            `json:"count"`
+	Paid     bool              `json:"paid"`
+	Note     *string           `json:"note"`
+	Blob     []byte            `json:"blob"`
+	Big      json.Number       `json:"big"`
+	Created  time.Time         `json:"created"`
+	Address  map[string]string `json:"address"`
+	Lines    []Line            `json:"lines"`
+	Tags     []string          `dynamodbav:"tags,stringset"`
+	Scores   []int             `dynamodbav:"scores,numberset"`
+	Hashes   [][]byte          `dynamodbav:"hashes,binaryset"`
+	Extra    interface{}       `json:"extra"`
+	Empty    string            `json:"empty,omitempty"`
+	Ignored  string            `json:"-"`
+	internal string
+}
+
+type audit struct {
+	UpdatedBy string    `json:"updatedBy"`
+	Updated   time.Time `json:"updated"`
+}
+
+type Item struct {
+	*audit
+	ID string `json:"id"`
+}
+
+func TestImageRoundTrip(t *testing.T) {
+	// Given
+	item := map[string]zephyr.AttributeValue{
+		"createdBy": {S: aws.String("joe")},
+		"id":        {S: aws.String("abc")},
+		"total":     {N: aws.String("1234")},
+		"discount":  {N: aws.String("0.5")},
+		"count":     {N: aws.String("3")},
+		"paid":      {BOOL: aws.Bool(true)},
+		"note":      {NULL: aws.Bool(true)},
+		"blob":      {B: []byte("hello")},
+		"big":       {N: aws.String("12345678901234567890.123")},
+		"created":   {S: aws.String("2016-01-02T03:04:05.123Z")},
+		"address":   {M: map[string]zephyr.AttributeValue{"city": {S: aws.String("Seattle")}}},
+		"lines": {L: []zephyr.AttributeValue{
+			{M: map[string]zephyr.AttributeValue{
+				"sku":   {S: aws.String("a-1")},
+				"qty":   {N: aws.String("2")},
+				"price": {N: aws.String("9.99")},
+			}},
+		}},
+		"tags":   {SS: []*string{aws.String("new"), aws.String("priority")}},
+		"scores": {NS: []*string{aws.String("1"), aws.String("2")}},
+		"hashes": {BS: [][]byte{[]byte("x"), []byte("y")}},
+		"extra": {M: map[string]zephyr.AttributeValue{
+			"list": {L: []zephyr.AttributeValue{{S: aws.String("a")}, {N: aws.String("1")}}},
+		}},
+	}
+
+	// When
+	var order Order
+	if err := zephyr.UnmarshalImage(item, &order); err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	// Then
+	if order.CreatedBy != "joe" || order.ID != "abc" || order.Total != 1234 || order.Discount != 0.5 || order.Count != 3 {
+		t.Errorf("unexpected scalars, %#v", order)
+	}
+	if !order.Paid || order.Note != nil || string(order.Blob) != "hello" || order.Big != "12345678901234567890.123" {
+		t.Errorf("unexpected scalars, %#v", order)
+	}
+	if expected := time.Date(2016, 1, 2, 3, 4, 5, 123e6, time.UTC); !order.Created.Equal(expected) {
+		t.Errorf("expected %v; got %v", expected, order.Created)
+	}
+	if order.Address["city"] != "Seattle" {
+		t.Errorf("expected Seattle; got %v", order.Address)
+	}
+	if expected := []Line{{SKU: "a-1", Quantity: 2, Price: 9.99}}; !reflect.DeepEqual(expected, order.Lines) {
+		t.Errorf("expected %v; got %v", expected, order.Lines)
+	}
+	if !reflect.DeepEqual([]string{"new", "priority"}, order.Tags) || !reflect.DeepEqual([]int{1, 2}, order.Scores) {
+		t.Errorf("unexpected sets, %v %v", order.Tags, order.Scores)
+	}
+	if len(order.Hashes) != 2 || string(order.Hashes[1]) != "y" {
+		t.Errorf("unexpected binary set, %v", order.Hashes)
+	}
+	if expected := map[string]interface{}{"list": []interface{}{"a", json.Number("1")}}; !reflect.DeepEqual(expected, order.Extra) {
+		t.Errorf("expected %v; got %v", expected, order.Extra)
+	}
+
+	// When
+	image, err := zephyr.MarshalImage(order)
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	// Then
+	if !reflect.DeepEqual(item, image) {
+		expected, _ := zephyr.MarshalPlainImage(item)
+		actual, _ := zephyr.MarshalPlainImage(image)
+		t.Errorf("expected %s; got %s", expected, actual)
+	}
+}
+
+func TestMarshalImageOmitEmpty(t *testing.T) {
+	image, err := zephyr.MarshalImage(&Order{Empty: "set", Ignored: "x"})
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if v := image["empty"]; v.S == nil || *v.S != "set" {
+		t.Errorf("expected empty to be set; got %v", v)
+	}
+	if _, ok := image["Ignored"]; ok {
+		t.Errorf("expected Ignored to be skipped")
+	}
+
+	image, _ = zephyr.MarshalImage(Order{})
+	if _, ok := image["empty"]; ok {
+		t.Errorf("expected empty to be omitted")
+	}
+}
+
+func TestImageMap(t *testing.T) {
+	// Given
+	item := map[string]zephyr.AttributeValue{
+		"a": {N: aws.String("1")},
+		"b": {N: aws.String("2")},
+	}
+
+	// When
+	var m map[string]int
+	if err := zephyr.UnmarshalImage(item, &m); err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	image, err := zephyr.MarshalImage(m)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if !reflect.DeepEqual(item, image) {
+		t.Errorf("expected %v; got %v", item, image)
+	}
+}
+
+func TestImageErrors(t *testing.T) {
+	var order Order
+	if err := zephyr.UnmarshalImage(nil, order); err != zephyr.ErrInvalidUnmarshal {
+		t.Errorf("expected %v; got %v", zephyr.ErrInvalidUnmarshal, err)
+	}
+	if _, err := zephyr.MarshalImage("abc"); err != zephyr.ErrInvalidMarshal {
+		t.Errorf("expected %v; got %v", zephyr.ErrInvalidMarshal, err)
+	}
+
+	item := map[string]zephyr.AttributeValue{"total": {S: aws.String("abc")}}
+	if err := zephyr.UnmarshalImage(item, &order); err == nil {
+		t.Errorf("expected type error; got nil")
+	}
+}
+
+func TestImageUnexportedEmbeddedPointer(t *testing.T) {
+	updated := time.Date(2016, 11, 18, 20, 9, 0, 0, time.UTC)
+	item := map[string]zephyr.AttributeValue{
+		"id":        {S: aws.String("1")},
+		"updatedBy": {S: aws.String("joe")},
+		"updated":   {S: aws.String(updated.Format(time.RFC3339Nano))},
+	}
+
+	// When
+	var nilAudit Item
+	err := zephyr.UnmarshalImage(item, &nilAudit)
+
+	// Then
+	if err == nil {
+		t.Errorf("expected error setting nil unexported embedded pointer; got nil")
+	}
+
+	// When
+	v, err := zephyr.MarshalImage(Item{ID: "1"})
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if expected := map[string]zephyr.AttributeValue{"id": {S: aws.String("1")}}; !reflect.DeepEqual(expected, v) {
+		t.Errorf("expected %v; got %v", expected, v)
+	}
+
+	// When
+	withAudit := Item{audit: &audit{}}
+	err = zephyr.UnmarshalImage(item, &withAudit)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	expected := Item{audit: &audit{UpdatedBy: "joe", Updated: updated}, ID: "1"}
+	if !reflect.DeepEqual(expected, withAudit) {
+		t.Errorf("expected %#v; got %#v", expected, withAudit)
+	}
+
+	// When
+	v, err = zephyr.MarshalImage(withAudit)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if !reflect.DeepEqual(item, v) {
+		t.Errorf("expected %v; got %v", item, v)
+	}
+}
@@ -0,0 +1,261 @@
+package zephyr
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/savaki/zap"
+)
+
+const (
+	MetricRecordsReceived   = "RecordsReceived"
+	MetricRecordsFiltered   = "RecordsFiltered"
+	MetricRecordsFailed     = "RecordsFailed"
+	MetricMessagesPublished = "MessagesPublished"
+	MetricMessagesFailed    = "MessagesFailed"
+	MetricPublishLatency    = "PublishLatency"
+	MetricCacheHits         = "TopicArnCacheHits"
+	MetricCacheMisses       = "TopicArnCacheMisses"
+	MetricBatchSize         = "BatchSize"
+)
+
+const (
+	DimensionTable = "table"
+	DimensionEnv   = "env"
+	DimensionTopic = "topic"
+)
+
+const (
+	UnitCount        = "Count"
+	UnitMilliseconds = "Milliseconds"
+)
+
+// DefaultMetricsNamespace is the CloudWatch namespace WithEMFMetrics uses when none is
+// given
+const DefaultMetricsNamespace = "zephyr"
+
+// Metric is a single measurement; Dimensions holds the table, env and topic it applies
+// to, where known
+type Metric struct {
+	Name       string
+	Unit       string
+	Value      float64
+	Dimensions map[string]string
+}
+
+// ---- MetricsSink -------------------------------------------------------------
+
+type PutMetricsFunc func(metrics []Metric) error
+
+func (fn PutMetricsFunc) PutMetrics(metrics []Metric) error {
+	return fn(metrics)
+}
+
+// MetricsSink receives the metrics recorded during an invocation once it completes
+type MetricsSink interface {
+	PutMetrics(metrics []Metric) error
+}
+
+// EMFSink writes metrics in CloudWatch Embedded Metric Format, one JSON document per
+// set of dimensions.  Count metrics are summed; other metrics are written as arrays of
+// values so CloudWatch can compute their statistics.
+type EMFSink struct {
+	Namespace string
+
+	w   io.Writer
+	now func() time.Time
+}
+
+func NewEMFSink(namespace string, w io.Writer) *EMFSink {
+	if namespace == "" {
+		namespace = DefaultMetricsNamespace
+	}
+
+	return &EMFSink{
+		Namespace: namespace,
+		w:         w,
+		now:       time.Now,
+	}
+}
+
+type emfMetric struct {
+	Name string
+	Unit string
+}
+
+type emfDirective struct {
+	Namespace  string
+	Dimensions [][]string
+	Metrics    []emfMetric
+}
+
+type emfMetadata struct {
+	Timestamp         int64
+	CloudWatchMetrics []emfDirective
+}
+
+type emfGroup struct {
+	dimensions map[string]string
+	names      []string
+	units      map[string]string
+	values     map[string][]float64
+}
+
+func (s *EMFSink) PutMetrics(metrics []Metric) error {
+	var keys []string
+	groups := map[string]*emfGroup{}
+
+	for _, m := range metrics {
+		key := dimensionsKey(m.Dimensions)
+		g, ok := groups[key]
+		if !ok {
+			g = &emfGroup{
+				dimensions: m.Dimensions,
+				units:      map[string]string{},
+				values:     map[string][]float64{},
+			}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+
+		if _, ok := g.units[m.Name]; !ok {
+			g.names = append(g.names, m.Name)
+			g.units[m.Name] = m.Unit
+		}
+		g.values[m.Name] = append(g.values[m.Name], m.Value)
+	}
+
+	sort.Strings(keys)
+	timestamp := s.now().UnixNano() / int64(time.Millisecond)
+
+	for _, key := range keys {
+		g := groups[key]
+		sort.Strings(g.names)
+
+		dimensionNames := make([]string, 0, len(g.dimensions))
+		for name := range g.dimensions {
+			dimensionNames = append(dimensionNames, name)
+		}
+		sort.Strings(dimensionNames)
+
+		directive := emfDirective{
+			Namespace:  s.Namespace,
+			Dimensions: [][]string{dimensionNames},
+		}
+
+		doc := map[string]interface{}{}
+		for name, value := range g.dimensions {
+			doc[name] = value
+		}
+		for _, name := range g.names {
+			unit := g.units[name]
+			directive.Metrics = append(directive.Metrics, emfMetric{Name: name, Unit: unit})
+			doc[name] = emfValue(unit, g.values[name])
+		}
+		doc["_aws"] = emfMetadata{
+			Timestamp:         timestamp,
+			CloudWatchMetrics: []emfDirective{directive},
+		}
+
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		if _, err := s.w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func emfValue(unit string, values []float64) interface{} {
+	if unit == UnitCount {
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	}
+
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+func dimensionsKey(dimensions map[string]string) string {
+	pairs := make([]string, 0, len(dimensions))
+	for k, v := range dimensions {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// ---- Handler -----------------------------------------------------------------
+
+// metrics buffers the metrics recorded during an invocation
+type metrics struct {
+	mux    sync.Mutex
+	points []Metric
+}
+
+func (m *metrics) add(metric Metric) {
+	m.mux.Lock()
+	m.points = append(m.points, metric)
+	m.mux.Unlock()
+}
+
+func (m *metrics) drain() []Metric {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	points := m.points
+	m.points = nil
+	return points
+}
+
+// putMetric records a metric when the handler has a MetricsSink
+func (h *Handler) putMetric(name, unit string, value float64, dimensions map[string]string) {
+	if h.metricsSink == nil {
+		return
+	}
+
+	h.metrics.add(Metric{
+		Name:       name,
+		Unit:       unit,
+		Value:      value,
+		Dimensions: dimensions,
+	})
+}
+
+// dimensions returns the table, env and topic dimensions that are known
+func dimensions(record Record, env, topicName string) map[string]string {
+	d := map[string]string{}
+	if tableName, ok := TableName(record); ok {
+		d[DimensionTable] = tableName
+	}
+	if env != "" {
+		d[DimensionEnv] = env
+	}
+	if topicName != "" {
+		d[DimensionTopic] = topicName
+	}
+	return d
+}
+
+// flushMetrics sends the metrics recorded during the invocation to the sink
+func (h *Handler) flushMetrics() {
+	if h.metricsSink == nil {
+		return
+	}
+
+	if err := h.metricsSink.PutMetrics(h.metrics.drain()); err != nil {
+		h.log.Warn("zephyr:err:metrics", zap.Err(err))
+	}
+}
@@ -0,0 +1,127 @@
+package zephyr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zap"
+)
+
+func TestEMFSink(t *testing.T) {
+	// Given
+	w := &bytes.Buffer{}
+	sink := NewEMFSink("", w)
+	sink.now = func() time.Time { return time.Unix(1479499740, 0) }
+
+	topic := map[string]string{DimensionTable: "orders", DimensionTopic: "orders-open"}
+
+	// When
+	err := sink.PutMetrics([]Metric{
+		{Name: MetricBatchSize, Unit: UnitCount, Value: 2},
+		{Name: MetricMessagesPublished, Unit: UnitCount, Value: 1, Dimensions: topic},
+		{Name: MetricMessagesPublished, Unit: UnitCount, Value: 1, Dimensions: topic},
+		{Name: MetricPublishLatency, Unit: UnitMilliseconds, Value: 12, Dimensions: topic},
+		{Name: MetricPublishLatency, Unit: UnitMilliseconds, Value: 14, Dimensions: topic},
+	})
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	expected := `{"BatchSize":2,"_aws":{"Timestamp":1479499740000,"CloudWatchMetrics":[{"Namespace":"zephyr","Dimensions":[[]],"Metrics":[{"Name":"BatchSize","Unit":"Count"}]}]}}
+{"MessagesPublished":2,"PublishLatency":[12,14],"_aws":{"Timestamp":1479499740000,"CloudWatchMetrics":[{"Namespace":"zephyr","Dimensions":[["table","topic"]],"Metrics":[{"Name":"MessagesPublished","Unit":"Count"},{"Name":"PublishLatency","Unit":"Milliseconds"}]}]},"table":"orders","topic":"orders-open"}
+`
+	if w.String() != expected {
+		t.Errorf("expected %v; got %v", expected, w.String())
+	}
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{
+			"eventName": "INSERT",
+			"eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/2016-05-16T22:22:50.550",
+			"dynamodb": { "SequenceNumber": "100" }
+		},
+		{
+			"eventName": "REMOVE",
+			"eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/2016-05-16T22:22:50.550",
+			"dynamodb": { "SequenceNumber": "101" }
+		},
+		{
+			"eventName": "MODIFY",
+			"eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/2016-05-16T22:22:50.550",
+			"dynamodb": { "SequenceNumber": "102" }
+		}
+	]
+}`
+
+	totals := map[string]float64{}
+	var topics []string
+
+	// Given
+	handler := New(
+		WithEnvIdentifier(EnvIdentifierFunc(func(record Record) (string, bool) {
+			return "prod", true
+		})),
+		WithRecordFilter(Not(EventNames(Remove))),
+		WithTopicNameFunc(func(record Record) (string, error) {
+			return "orders-" + record.EventName, nil
+		}),
+		WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			if *topicArn == "orders-MODIFY" {
+				return errors.New("boom")
+			}
+			return nil
+		}),
+		WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+		WithMetricsSink(PutMetricsFunc(func(metrics []Metric) error {
+			for _, m := range metrics {
+				totals[m.Name] += m.Value
+				if m.Name == MetricMessagesPublished {
+					topics = append(topics, m.Dimensions[DimensionTopic])
+					if m.Dimensions[DimensionTable] != "orders" || m.Dimensions[DimensionEnv] != "prod" {
+						t.Errorf("expected table and env dimensions; got %v", m.Dimensions)
+					}
+				}
+			}
+			return nil
+		})),
+		WithPartialBatchResponse(),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	expected := map[string]float64{
+		MetricBatchSize:         3,
+		MetricRecordsReceived:   3,
+		MetricRecordsFiltered:   1,
+		MetricRecordsFailed:     1,
+		MetricMessagesPublished: 1,
+		MetricMessagesFailed:    1,
+		MetricCacheMisses:       2,
+	}
+	for name, value := range expected {
+		if totals[name] != value {
+			t.Errorf("expected %v %v; got %v", name, value, totals[name])
+		}
+	}
+	if len(topics) != 1 || topics[0] != "orders-INSERT" {
+		t.Errorf("expected orders-INSERT; got %v", topics)
+	}
+}
@@ -2,6 +2,8 @@ package zephyr
 
 import (
 	"io"
+	"os"
+	"time"
 
 	"github.com/savaki/zap"
 )
@@ -16,23 +18,48 @@ func WithHandler(handler interface{}) Option {
 		}
 
 		switch v := handler.(type) {
-		case TopicNamer:
+		case TopicNamerContext:
 			h.namer = v
+		case TopicNamer:
+			h.namer = asTopicNamerContext(v)
 		}
 
 		switch v := handler.(type) {
-		case MessageExtractor:
+		case MultiTopicNamer:
+			h.multiNamer = v
+		}
+
+		switch v := handler.(type) {
+		case MessageExtractorContext:
 			h.extractor = v
+		case MessageExtractor:
+			h.extractor = asMessageExtractorContext(v)
 		}
 
 		switch v := handler.(type) {
-		case Publisher:
+		case MessageAttributer:
+			h.attributer = v
+		}
+
+		if v := asMessagePublisherContext(handler); v != nil {
 			h.publisher = v
 		}
 
 		switch v := handler.(type) {
-		case TopicArnFinder:
+		case TopicArnFinderContext:
 			h.finder = v
+		case TopicArnFinder:
+			h.finder = asTopicArnFinderContext(v)
+		}
+
+		switch v := handler.(type) {
+		case DeadLetterSink:
+			h.deadLetters = v
+		}
+
+		switch v := handler.(type) {
+		case RecordFilter:
+			h.filter = v
 		}
 	}
 }
@@ -44,6 +71,12 @@ func WithEnvIdentifier(v EnvIdentifier) Option {
 }
 
 func WithTopicNamer(v TopicNamer) Option {
+	return func(h *Handler) {
+		h.namer = asTopicNamerContext(v)
+	}
+}
+
+func WithTopicNamerContext(v TopicNamerContext) Option {
 	return func(h *Handler) {
 		h.namer = v
 	}
@@ -55,27 +88,193 @@ func WithTopicNameFunc(fn TopicNameFunc) Option {
 	}
 }
 
+// WithMultiTopicNamer publishes each record to every topic v names, in addition to the
+// topic named by the TopicNamer
+func WithMultiTopicNamer(v MultiTopicNamer) Option {
+	return func(h *Handler) {
+		h.multiNamer = v
+	}
+}
+
+func WithTopicNamesFunc(fn TopicNamesFunc) Option {
+	return func(h *Handler) {
+		h.multiNamer = fn
+	}
+}
+
 func WithMessageExtractor(v MessageExtractor) Option {
+	return func(h *Handler) {
+		h.extractor = asMessageExtractorContext(v)
+	}
+}
+
+func WithMessageExtractorContext(v MessageExtractorContext) Option {
 	return func(h *Handler) {
 		h.extractor = v
 	}
 }
 
+// WithMessageAttributer adds the SNS message attributes v provides to each message
+func WithMessageAttributer(v MessageAttributer) Option {
+	return func(h *Handler) {
+		h.attributer = v
+	}
+}
+
+func WithMessageAttributesFunc(fn MessageAttributesFunc) Option {
+	return func(h *Handler) {
+		h.attributer = fn
+	}
+}
+
+// WithPlainJSON publishes records as PlainJSONMessage does, with images converted from
+// DynamoDB's typed JSON to natural JSON
+func WithPlainJSON() Option {
+	return func(h *Handler) {
+		h.extractor = ExtractMessageFunc(PlainJSONMessage)
+	}
+}
+
+// WithDiffMessage publishes only the attributes that changed, as DiffExtractor does;
+// includeNewImage adds the complete NewImage to each message
+func WithDiffMessage(includeNewImage bool) Option {
+	return func(h *Handler) {
+		h.extractor = asMessageExtractorContext(DiffExtractor{IncludeNewImage: includeNewImage})
+	}
+}
+
+// WithRecordFilter drops records for which the filter returns false before they are
+// routed
+func WithRecordFilter(v RecordFilter) Option {
+	return func(h *Handler) {
+		h.filter = v
+	}
+}
+
+func WithFilterRecordFunc(fn func(record Record) bool) Option {
+	return WithRecordFilter(FilterRecordFunc(fn))
+}
+
+// WithTransform applies transforms, in order, to the Keys, NewImage and OldImage of
+// records published to topics matching the path.Match pattern; use * for every topic.
+// Transforms registered by repeated options are applied in the order given.  With
+// WithFIFOTopics, patterns are matched against names before the .fifo suffix is added.
+func WithTransform(pattern string, transforms ...Transform) Option {
+	return func(h *Handler) {
+		h.transforms = append(h.transforms, topicTransform{
+			pattern:   pattern,
+			transform: Transforms(transforms...),
+		})
+	}
+}
+
+// WithCloudEvents wraps every message in a CloudEvents 1.0 structured JSON envelope
+func WithCloudEvents(opts CloudEventsOptions) Option {
+	return func(h *Handler) {
+		h.cloudEvents = &opts
+	}
+}
+
+// WithMessageEncoder publishes records in the encoder's binary format, base64 encoded,
+// and sets the contentType message attribute.  It replaces the MessageExtractor, so a
+// later option that sets an extractor turns encoding off again.
+func WithMessageEncoder(v MessageEncoder) Option {
+	return func(h *Handler) {
+		h.extractor = asMessageExtractorContext(EncodedMessageExtractor{Encoder: v})
+	}
+}
+
+// WithMetricsSink sends the metrics recorded during each invocation to sink
+func WithMetricsSink(sink MetricsSink) Option {
+	return func(h *Handler) {
+		h.metricsSink = sink
+	}
+}
+
+// WithEMFMetrics writes metrics to the handler's Output in CloudWatch Embedded Metric
+// Format under namespace, DefaultMetricsNamespace when empty
+func WithEMFMetrics(namespace string) Option {
+	return func(h *Handler) {
+		if namespace == "" {
+			namespace = DefaultMetricsNamespace
+		}
+		h.metricsNamespace = namespace
+	}
+}
+
+// WithTimeout makes the handler deadline aware; timeout is the function's configured
+// Lambda timeout, which the invocation context does not carry.  Once less than margin
+// remains, DefaultSafetyMargin when 0, no new records are started and the rest of the
+// batch is reported as failed.  Only WithPartialBatchResponse limits the retry to those
+// records; without it the invocation returns ErrDeadlineExceeded and Lambda retries the
+// whole batch.
+func WithTimeout(timeout, margin time.Duration) Option {
+	return func(h *Handler) {
+		if margin <= 0 {
+			margin = DefaultSafetyMargin
+		}
+		h.timeout = timeout
+		h.safetyMargin = margin
+	}
+}
+
+// WithTimeoutFromEnv is WithTimeout with the timeout read from TimeoutEnv.  The handler
+// is not deadline aware when the variable is unset or not a valid duration.
+func WithTimeoutFromEnv(margin time.Duration) Option {
+	return func(h *Handler) {
+		timeout, err := time.ParseDuration(os.Getenv(TimeoutEnv))
+		if err != nil || timeout <= 0 {
+			return
+		}
+		WithTimeout(timeout, margin)(h)
+	}
+}
+
 func WithPublisher(v Publisher) Option {
+	return func(h *Handler) {
+		h.publisher = asMessagePublisherContext(v)
+	}
+}
+
+func WithPublisherContext(v PublisherContext) Option {
+	return func(h *Handler) {
+		h.publisher = asMessagePublisherContext(v)
+	}
+}
+
+func WithMessagePublisher(v MessagePublisher) Option {
+	return func(h *Handler) {
+		h.publisher = asMessagePublisherContext(v)
+	}
+}
+
+func WithMessagePublisherContext(v MessagePublisherContext) Option {
 	return func(h *Handler) {
 		h.publisher = v
 	}
 }
 
-func WithPublishFunc(fn PublishFunc) Option {
+func WithPublishMessageFunc(fn PublishMessageFunc) Option {
 	return func(h *Handler) {
 		h.publisher = fn
 	}
 }
 
+func WithPublishFunc(fn PublishFunc) Option {
+	return func(h *Handler) {
+		h.publisher = asMessagePublisherContext(fn)
+	}
+}
+
 func WithTopicArnFinder(fn TopicArnFinder) Option {
 	return func(h *Handler) {
-		h.finder = fn
+		h.finder = asTopicArnFinderContext(fn)
+	}
+}
+
+func WithTopicArnFinderContext(v TopicArnFinderContext) Option {
+	return func(h *Handler) {
+		h.finder = v
 	}
 }
 
@@ -85,6 +284,113 @@ func WithFindTopicArnFunc(fn FindTopicArnFunc) Option {
 	}
 }
 
+// WithPartialBatchResponse returns a BatchResponse listing only the records that failed,
+// so Lambda retries just those.  The event source mapping must have
+// FunctionResponseTypes set to ReportBatchItemFailures; otherwise Lambda ignores the
+// response, treats the invocation as a success and the failed records are lost.
+// Without this option a failed record fails the invocation and the whole batch is
+// retried.
+func WithPartialBatchResponse() Option {
+	return func(h *Handler) {
+		h.partialBatchResponse = true
+	}
+}
+
+// WithRetryPolicy retries failed calls to the Publisher and TopicArnFinder
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(h *Handler) {
+		h.retry = &policy
+	}
+}
+
+// WithDeadLetterSink keeps records that could not be named or extracted rather than
+// skipping or failing them
+func WithDeadLetterSink(v DeadLetterSink) Option {
+	return func(h *Handler) {
+		h.deadLetters = v
+	}
+}
+
+func WithDeadLetterFunc(fn DeadLetterFunc) Option {
+	return func(h *Handler) {
+		h.deadLetters = fn
+	}
+}
+
+// WithConcurrency publishes up to n records in parallel; records that share the same
+// Keys are still published one at a time in SequenceNumber order
+func WithConcurrency(n int) Option {
+	return func(h *Handler) {
+		h.concurrency = n
+	}
+}
+
+// WithFIFOTopics publishes to SNS FIFO topics.  FIFOSuffix is appended to each topic
+// name and every message carries a MessageGroupId and MessageDeduplicationId; by default
+// derived from the record's Keys and EventID respectively.
+func WithFIFOTopics() Option {
+	return func(h *Handler) {
+		h.fifo = true
+	}
+}
+
+func WithMessageGroupIDFunc(fn MessageGroupIDFunc) Option {
+	return func(h *Handler) {
+		h.groupID = fn
+	}
+}
+
+func WithDeduplicationIDFunc(fn DeduplicationIDFunc) Option {
+	return func(h *Handler) {
+		h.deduplicationID = fn
+	}
+}
+
+// WithClaimCheck stores message bodies larger than threshold bytes in store and publishes
+// a ClaimCheck in their place; a threshold <= 0 uses DefaultClaimCheckThreshold.
+// When WithCloudEvents is used, the threshold applies to the event data and the claim
+// check is wrapped in the event.  Subscribers use ResolveClaimCheck to recover the original message.
+func WithClaimCheck(store BlobStore, threshold int) Option {
+	return func(h *Handler) {
+		if threshold <= 0 {
+			threshold = DefaultClaimCheckThreshold
+		}
+		h.blobs = store
+		h.claimCheckThreshold = threshold
+	}
+}
+
+// WithTopicArnCache configures expiry, size and negative caching of topic arns
+func WithTopicArnCache(opts CacheOptions) Option {
+	return func(h *Handler) {
+		h.cacheOptions = opts
+	}
+}
+
+// WithUnknownTopicPolicy determines how records are handled when their topic does not
+// exist; see NewAccountTopicArnFinder and NewListTopicsArnFinder for finders that do not
+// create topics
+func WithUnknownTopicPolicy(policy UnknownTopicPolicy) Option {
+	return func(h *Handler) {
+		h.unknownTopicPolicy = policy
+	}
+}
+
+// WithFallbackTopic publishes records whose topic does not exist to topicName
+func WithFallbackTopic(topicName string) Option {
+	return func(h *Handler) {
+		h.unknownTopicPolicy = UnknownTopicFallback
+		h.fallbackTopic = topicName
+	}
+}
+
+// WithTopicGuard restricts the topics records may be published to
+func WithTopicGuard(guard TopicGuard) Option {
+	return func(h *Handler) {
+		h.guard = &guard
+	}
+}
+
 func Output(w io.Writer) Option {
 	return func(h *Handler) {
 		h.writer = zap.AddSync(w)
@@ -0,0 +1,114 @@
+package zephyr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// PlainImage converts a DynamoDB image into natural JSON types: S to string, N to
+// json.Number without loss of precision, BOOL to bool, NULL to nil, B to a base64
+// string, M to map[string]interface{} and L, SS, NS and BS to []interface{}
+func PlainImage(item map[string]AttributeValue) map[string]interface{} {
+	if item == nil {
+		return nil
+	}
+
+	v := make(map[string]interface{}, len(item))
+	for key, av := range item {
+		v[key] = PlainValue(av)
+	}
+	return v
+}
+
+// PlainValue converts a single AttributeValue; see PlainImage
+func PlainValue(av AttributeValue) interface{} {
+	switch {
+	case av.S != nil:
+		return *av.S
+	case av.N != nil:
+		return json.Number(*av.N)
+	case av.BOOL != nil:
+		return *av.BOOL
+	case av.NULL != nil:
+		return nil
+	case av.B != nil:
+		return base64.StdEncoding.EncodeToString(av.B)
+	case av.M != nil:
+		return PlainImage(av.M)
+	case av.L != nil:
+		list := make([]interface{}, len(av.L))
+		for i, item := range av.L {
+			list[i] = PlainValue(item)
+		}
+		return list
+	case av.SS != nil:
+		list := make([]interface{}, len(av.SS))
+		for i, item := range av.SS {
+			list[i] = *item
+		}
+		return list
+	case av.NS != nil:
+		list := make([]interface{}, len(av.NS))
+		for i, item := range av.NS {
+			list[i] = json.Number(*item)
+		}
+		return list
+	case av.BS != nil:
+		list := make([]interface{}, len(av.BS))
+		for i, item := range av.BS {
+			list[i] = base64.StdEncoding.EncodeToString(item)
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+// MarshalPlainImage encodes a DynamoDB image as natural JSON
+func MarshalPlainImage(item map[string]AttributeValue) ([]byte, error) {
+	return json.Marshal(PlainImage(item))
+}
+
+type plainStreamRecord struct {
+	Keys           map[string]interface{} `json:",omitempty"`
+	NewImage       map[string]interface{} `json:",omitempty"`
+	OldImage       map[string]interface{} `json:",omitempty"`
+	SequenceNumber string
+	SizeBytes      int64
+	StreamViewType string
+}
+
+type plainRecord struct {
+	AwsRegion      string            `json:"awsRegion"`
+	Dynamodb       plainStreamRecord `json:"dynamodb"`
+	EventID        string            `json:"eventID"`
+	EventName      string            `json:"eventName"`
+	EventSource    string            `json:"eventSource"`
+	EventSourceARN string            `json:"eventSourceARN"`
+	EventVersion   string            `json:"eventVersion"`
+}
+
+// PlainJSONMessage publishes the whole record, like the default extractor, with its
+// Keys, NewImage and OldImage converted to natural JSON
+func PlainJSONMessage(r Record) (string, error) {
+	data, err := json.Marshal(plainRecord{
+		AwsRegion: r.AwsRegion,
+		Dynamodb: plainStreamRecord{
+			Keys:           PlainImage(r.Dynamodb.Keys),
+			NewImage:       PlainImage(r.Dynamodb.NewImage),
+			OldImage:       PlainImage(r.Dynamodb.OldImage),
+			SequenceNumber: r.Dynamodb.SequenceNumber,
+			SizeBytes:      r.Dynamodb.SizeBytes,
+			StreamViewType: r.Dynamodb.StreamViewType,
+		},
+		EventID:        r.EventID,
+		EventName:      r.EventName,
+		EventSource:    r.EventSource,
+		EventSourceARN: r.EventSourceARN,
+		EventVersion:   r.EventVersion,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,64 @@
+package zephyr_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zephyr"
+)
+
+func TestMarshalPlainImage(t *testing.T) {
+	item := map[string]zephyr.AttributeValue{
+		"s":    {S: aws.String("hello")},
+		"n":    {N: aws.String("12345678901234567890.123")},
+		"bool": {BOOL: aws.Bool(true)},
+		"null": {NULL: aws.Bool(true)},
+		"b":    {B: []byte("abc")},
+		"m":    {M: map[string]zephyr.AttributeValue{"a": {N: aws.String("1")}}},
+		"l":    {L: []zephyr.AttributeValue{{S: aws.String("x")}, {N: aws.String("2")}}},
+		"ss":   {SS: []*string{aws.String("a"), aws.String("b")}},
+		"ns":   {NS: []*string{aws.String("1"), aws.String("2.5")}},
+		"bs":   {BS: [][]byte{[]byte("abc")}},
+	}
+
+	data, err := zephyr.MarshalPlainImage(item)
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	expected := `{"b":"YWJj","bool":true,"bs":["YWJj"],"l":["x",2],"m":{"a":1},"n":12345678901234567890.123,"ns":[1,2.5],"null":null,"s":"hello","ss":["a","b"]}`
+	if string(data) != expected {
+		t.Errorf("expected %v; got %v", expected, string(data))
+	}
+}
+
+func TestPlainJSONMessage(t *testing.T) {
+	r := zephyr.Record{
+		EventName: zephyr.Insert,
+		Dynamodb: zephyr.StreamRecord{
+			Keys:           map[string]zephyr.AttributeValue{"id": {S: aws.String("123")}},
+			NewImage:       map[string]zephyr.AttributeValue{"id": {S: aws.String("123")}, "total": {N: aws.String("10")}},
+			SequenceNumber: "100",
+		},
+	}
+
+	message, err := zephyr.PlainJSONMessage(r)
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	var v struct {
+		EventName string `json:"eventName"`
+		Dynamodb  struct {
+			Keys     map[string]interface{}
+			NewImage map[string]interface{}
+		} `json:"dynamodb"`
+	}
+	if err := json.Unmarshal([]byte(message), &v); err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if v.EventName != zephyr.Insert || v.Dynamodb.Keys["id"] != "123" || v.Dynamodb.NewImage["total"] != float64(10) {
+		t.Errorf("unexpected message, %v", message)
+	}
+}
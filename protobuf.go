@@ -0,0 +1,166 @@
+package zephyr
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// ProtobufContentType identifies messages encoded by ProtobufEncoder
+const ProtobufContentType = "application/x-protobuf; messageType=zephyr.Record"
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// ProtobufEncoder encodes records as the zephyr.Record message defined in
+// record.proto.  Map entries are written in key order so equal records encode
+// identically.
+type ProtobufEncoder struct{}
+
+func (ProtobufEncoder) ContentType() string {
+	return ProtobufContentType
+}
+
+func (ProtobufEncoder) EncodeRecord(record Record) ([]byte, error) {
+	var b protoBuffer
+	b.string(1, record.AwsRegion)
+	b.message(2, encodeProtoStreamRecord(record.Dynamodb))
+	b.string(3, record.EventID)
+	b.string(4, record.EventName)
+	b.string(5, record.EventSource)
+	b.string(6, record.EventSourceARN)
+	b.string(7, record.EventVersion)
+	return b, nil
+}
+
+func encodeProtoStreamRecord(r StreamRecord) protoBuffer {
+	var b protoBuffer
+	b.attributeMap(1, r.Keys)
+	b.attributeMap(2, r.NewImage)
+	b.attributeMap(3, r.OldImage)
+	b.string(4, r.SequenceNumber)
+	if r.SizeBytes != 0 {
+		b.tag(5, wireVarint)
+		b.varint(uint64(r.SizeBytes))
+	}
+	b.string(6, r.StreamViewType)
+	if r.ApproximateCreationDateTime != 0 {
+		b.tag(7, wireFixed64)
+		b = append(b, make([]byte, 8)...)
+		binary.LittleEndian.PutUint64(b[len(b)-8:], math.Float64bits(r.ApproximateCreationDateTime))
+	}
+	return b
+}
+
+func encodeProtoAttributeValue(av AttributeValue) protoBuffer {
+	var b protoBuffer
+
+	switch {
+	case av.S != nil:
+		b.bytes(1, []byte(*av.S))
+	case av.N != nil:
+		b.bytes(2, []byte(*av.N))
+	case av.B != nil:
+		b.bytes(3, av.B)
+	case av.BOOL != nil:
+		b.bool(4, *av.BOOL)
+	case av.NULL != nil:
+		b.bool(5, *av.NULL)
+	case av.M != nil:
+		var m protoBuffer
+		m.attributeMap(1, av.M)
+		b.bytes(6, m)
+	case av.L != nil:
+		var l protoBuffer
+		for _, item := range av.L {
+			l.bytes(1, encodeProtoAttributeValue(item))
+		}
+		b.bytes(7, l)
+	case av.SS != nil:
+		b.bytes(8, encodeProtoStringSet(av.SS))
+	case av.NS != nil:
+		b.bytes(9, encodeProtoStringSet(av.NS))
+	case av.BS != nil:
+		var bs protoBuffer
+		for _, v := range av.BS {
+			bs.bytes(1, v)
+		}
+		b.bytes(10, bs)
+	}
+
+	return b
+}
+
+func encodeProtoStringSet(values []*string) protoBuffer {
+	var b protoBuffer
+	for _, v := range values {
+		if v != nil {
+			b.bytes(1, []byte(*v))
+		}
+	}
+	return b
+}
+
+// protoBuffer appends fields in the protobuf wire format
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *protoBuffer) tag(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// bytes writes a length delimited field, even when empty
+func (b *protoBuffer) bytes(field int, v []byte) {
+	b.tag(field, wireBytes)
+	b.varint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+// string writes a proto3 string field, omitting the default empty string
+func (b *protoBuffer) string(field int, v string) {
+	if v != "" {
+		b.bytes(field, []byte(v))
+	}
+}
+
+// message writes an embedded message field, omitting empty messages
+func (b *protoBuffer) message(field int, v protoBuffer) {
+	if len(v) > 0 {
+		b.bytes(field, v)
+	}
+}
+
+func (b *protoBuffer) bool(field int, v bool) {
+	b.tag(field, wireVarint)
+	if v {
+		b.varint(1)
+	} else {
+		b.varint(0)
+	}
+}
+
+// attributeMap writes a map<string, AttributeValue> field as repeated entries
+func (b *protoBuffer) attributeMap(field int, item map[string]AttributeValue) {
+	keys := make([]string, 0, len(item))
+	for k := range item {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var entry protoBuffer
+		entry.bytes(1, []byte(k))
+		entry.bytes(2, encodeProtoAttributeValue(item[k]))
+		b.bytes(field, entry)
+	}
+}
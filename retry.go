@@ -0,0 +1,155 @@
+package zephyr
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/savaki/zap"
+	"golang.org/x/net/context"
+)
+
+// sleep waits for delay or until ctx is done; it is replaced in tests
+var sleep = func(ctx context.Context, delay time.Duration) error {
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RetryPolicy describes how calls to the Publisher and TopicArnFinder are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry; it doubles with each attempt
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between attempts
+	MaxDelay time.Duration
+
+	// Jitter is the fraction, 0 to 1, of each delay that is randomized
+	Jitter float64
+
+	// Retryable reports whether an error is worth retrying; defaults to IsRetryable
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy retries throttling and server errors three times
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+	Jitter:      0.5,
+	Retryable:   IsRetryable,
+}
+
+var retryableCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ThrottledException":                     true,
+	"RequestThrottled":                       true,
+	"RequestLimitExceeded":                   true,
+	"TooManyRequestsException":               true,
+	"ProvisionedThroughputExceededException": true,
+	"InternalError":                          true,
+	"InternalFailure":                        true,
+	"ServiceUnavailable":                     true,
+	"RequestTimeout":                         true,
+	"RequestTimeoutException":                true,
+	"KMSThrottling":                          true,
+}
+
+// IsRetryable reports true for throttling errors and 5xx responses from AWS
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if retryableCodes[ErrCode(err)] {
+		return true
+	}
+
+	if v, ok := err.(awserr.RequestFailure); ok {
+		return v.StatusCode() == 429 || v.StatusCode() >= 500
+	}
+
+	return false
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << uint(attempt-1)
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay <= 0) {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		jitter := time.Duration(float64(delay) * p.Jitter * rand.Float64())
+		delay = delay - time.Duration(float64(delay)*p.Jitter/2) + jitter
+	}
+
+	return delay
+}
+
+// do calls fn until it succeeds, fails with an error that isn't retryable, runs out of
+// attempts or ctx is done; ctx ending while waiting to retry returns ctx.Err()
+func (p RetryPolicy) do(ctx context.Context, logger zap.Logger, op string, fn func() error) error {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		logger.Warn("zephyr:retry",
+			zap.String("op", op),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay/time.Millisecond),
+			zap.Err(err),
+		)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// ---- Publisher ---------------------------------------------------------------
+
+type retryPublisher struct {
+	policy RetryPolicy
+	target MessagePublisherContext
+}
+
+func (r *retryPublisher) PublishMessageContext(ctx context.Context, logger zap.Logger, topicArn *string, message Message) error {
+	return r.policy.do(ctx, logger, "publish", func() error {
+		return r.target.PublishMessageContext(ctx, logger, topicArn, message)
+	})
+}
+
+// ---- TopicArnFinder ----------------------------------------------------------
+
+type retryTopicArnFinder struct {
+	policy RetryPolicy
+	target TopicArnFinderContext
+	log    zap.Logger
+}
+
+func (r *retryTopicArnFinder) FindTopicArnContext(ctx context.Context, topicName string) (*string, error) {
+	var topicArn *string
+	err := r.policy.do(ctx, r.log.With(zap.String("name", topicName)), "find_topic_arn", func() error {
+		arn, err := r.target.FindTopicArnContext(ctx, topicName)
+		if err != nil {
+			return err
+		}
+		topicArn = arn
+		return nil
+	})
+	return topicArn, err
+}
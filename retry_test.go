@@ -0,0 +1,146 @@
+package zephyr
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/savaki/zap"
+	"golang.org/x/net/context"
+)
+
+func TestRetryPublisher(t *testing.T) {
+	defer func(v func(context.Context, time.Duration) error) { sleep = v }(sleep)
+	sleep = func(context.Context, time.Duration) error { return nil }
+
+	logger := zap.NewJSON(zap.Output(zap.AddSync(ioutil.Discard)))
+	throttled := awserr.New("Throttling", "slow down", nil)
+
+	attempts := 0
+	p := &retryPublisher{
+		policy: DefaultRetryPolicy,
+		target: PublishMessageFunc(func(logger zap.Logger, topicArn *string, message Message) error {
+			attempts++
+			if attempts < 3 {
+				return throttled
+			}
+			return nil
+		}),
+	}
+
+	err := p.PublishMessageContext(context.Background(), logger, aws.String("arn"), Message{Body: "hello"})
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts; got %v", attempts)
+	}
+
+	// non-retryable errors return immediately
+
+	attempts = 0
+	boom := errors.New("boom")
+	p.target = PublishMessageFunc(func(logger zap.Logger, topicArn *string, message Message) error {
+		attempts++
+		return boom
+	})
+
+	err = p.PublishMessageContext(context.Background(), logger, aws.String("arn"), Message{Body: "hello"})
+	if err != boom {
+		t.Errorf("expected boom; got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt; got %v", attempts)
+	}
+
+	// cancelled contexts are not retried
+
+	attempts = 0
+	p.target = PublishMessageFunc(func(logger zap.Logger, topicArn *string, message Message) error {
+		attempts++
+		return throttled
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = p.PublishMessageContext(ctx, logger, aws.String("arn"), Message{Body: "hello"})
+	if err != throttled {
+		t.Errorf("expected throttled; got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt; got %v", attempts)
+	}
+}
+
+func TestRetryStopsWaitingWhenContextDone(t *testing.T) {
+	logger := zap.NewJSON(zap.Output(zap.AddSync(ioutil.Discard)))
+	throttled := awserr.New("Throttling", "slow down", nil)
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	started := time.Now()
+	err := policy.do(ctx, logger, "publish", func() error {
+		attempts++
+		return throttled
+	})
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected %v; got %v", context.DeadlineExceeded, err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt; got %v", attempts)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("expected retry to stop waiting when ctx is done; waited %v", elapsed)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		BaseDelay: 100 * time.Millisecond,
+		MaxDelay:  time.Second,
+	}
+
+	for attempt, expected := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		if delay := p.backoff(attempt + 1); delay != expected*time.Millisecond {
+			t.Errorf("attempt %v: expected %v; got %v", attempt+1, expected*time.Millisecond, delay)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := map[string]struct {
+		Err       error
+		Retryable bool
+	}{
+		"throttling": {
+			Err:       awserr.New("Throttling", "", nil),
+			Retryable: true,
+		},
+		"5xx": {
+			Err:       awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 503, ""),
+			Retryable: true,
+		},
+		"not-found": {
+			Err:       awserr.New("NotFound", "", nil),
+			Retryable: false,
+		},
+		"plain": {
+			Err:       errors.New("boom"),
+			Retryable: false,
+		},
+	}
+
+	for label, tc := range testCases {
+		if v := IsRetryable(tc.Err); v != tc.Retryable {
+			t.Errorf("%v: expected %v; got %v", label, tc.Retryable, v)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package rules
+
+import (
+	"encoding/json"
+
+	"github.com/savaki/zephyr"
+)
+
+// Document returns the record as plain JSON types, the shape rule conditions, topic
+// templates and message projections are evaluated against:
+//
+//	{
+//	  "eventID": "...", "eventName": "MODIFY", "eventSourceARN": "...", "awsRegion": "...",
+//	  "tableName": "orders", "sequenceNumber": "...",
+//	  "keys": {...}, "newImage": {...}, "oldImage": {...}
+//	}
+//
+// Numbers are float64 as required by JMESPath comparisons.
+func Document(record zephyr.Record) map[string]interface{} {
+	tableName, _ := zephyr.TableName(record)
+
+	return map[string]interface{}{
+		"eventID":        record.EventID,
+		"eventName":      record.EventName,
+		"eventSourceARN": record.EventSourceARN,
+		"awsRegion":      record.AwsRegion,
+		"tableName":      tableName,
+		"sequenceNumber": record.Dynamodb.SequenceNumber,
+		"keys":           image(record.Dynamodb.Keys),
+		"newImage":       image(record.Dynamodb.NewImage),
+		"oldImage":       image(record.Dynamodb.OldImage),
+	}
+}
+
+func image(item map[string]zephyr.AttributeValue) interface{} {
+	if item == nil {
+		return nil
+	}
+	return floats(zephyr.PlainImage(item))
+}
+
+// floats replaces the json.Numbers from zephyr.PlainImage with float64s
+func floats(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if f, err := value.Float64(); err == nil {
+			return f
+		}
+		return value.String()
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = floats(item)
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = floats(item)
+		}
+		return value
+	default:
+		return v
+	}
+}
@@ -0,0 +1,354 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/jmespath/go-jmespath"
+	"github.com/savaki/zephyr"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// MatchFirst routes a record using only the first rule whose condition matches
+	MatchFirst = "first"
+
+	// MatchAll routes a record to the topic of every rule whose condition matches
+	MatchAll = "all"
+)
+
+var (
+	ErrInvalidMatch      = errors.New("zephyr:rules:err:invalid_match")
+	ErrMissingTopic      = errors.New("zephyr:rules:err:missing_topic")
+	ErrUnterminatedField = errors.New("zephyr:rules:err:unterminated_field")
+	ErrEmptyTopic        = errors.New("zephyr:rules:err:empty_topic")
+	ErrNoMatch           = errors.New("zephyr:rules:err:no_match")
+)
+
+// Rule routes records whose Condition matches to Topic
+type Rule struct {
+	// Name identifies the rule in errors
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Condition is a JMESPath expression over the record's Document; the rule matches when
+	// it is truthy.  An empty Condition matches every record.
+	Condition string `json:"condition,omitempty" yaml:"condition,omitempty"`
+
+	// Topic is the topic name; {expr} is replaced with the JMESPath expression's value,
+	// e.g. {tableName}-{newImage.state}
+	Topic string `json:"topic" yaml:"topic"`
+
+	// Message is an optional JMESPath projection of the Document to publish; the whole
+	// Document is published when empty
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// Config is the contents of a rules file
+type Config struct {
+	// Match is either MatchFirst, the default, or MatchAll
+	Match string `json:"match,omitempty" yaml:"match,omitempty"`
+
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+type segment struct {
+	literal string
+	expr    *jmespath.JMESPath
+}
+
+type rule struct {
+	name      string
+	condition *jmespath.JMESPath
+	topic     []segment
+	message   *jmespath.JMESPath
+}
+
+// Router is a zephyr.MultiTopicNamer and zephyr.MessageExtractor driven by rules
+type Router struct {
+	matchAll bool
+	rules    []rule
+}
+
+type match struct {
+	topicName string
+	rule      rule
+}
+
+func (r *Router) matches(doc map[string]interface{}) ([]match, error) {
+	var matches []match
+
+	for _, rule := range r.rules {
+		if rule.condition != nil {
+			v, err := rule.condition.Search(doc)
+			if err != nil {
+				return nil, fmt.Errorf("rule %v: %v", rule.name, err)
+			}
+			if !truthy(v) {
+				continue
+			}
+		}
+
+		topicName, err := rule.topicName(doc)
+		if err != nil {
+			return nil, fmt.Errorf("rule %v: %v", rule.name, err)
+		}
+
+		matches = append(matches, match{topicName: topicName, rule: rule})
+		if !r.matchAll {
+			break
+		}
+	}
+
+	return matches, nil
+}
+
+func (r *Router) TopicNames(record zephyr.Record) ([]string, error) {
+	matches, err := r.matches(Document(record))
+	if err != nil {
+		return nil, err
+	}
+
+	topicNames := make([]string, 0, len(matches))
+	for _, m := range matches {
+		topicNames = append(topicNames, m.topicName)
+	}
+	return topicNames, nil
+}
+
+// ExtractTopicMessage publishes the projection of the first matching rule for topicName.
+// Handler appends zephyr.FIFOSuffix to topic names when publishing to FIFO topics, so
+// the suffix is ignored when no rule names the topic exactly.
+func (r *Router) ExtractTopicMessage(topicName string, record zephyr.Record) (string, error) {
+	doc := Document(record)
+
+	matches, err := r.matches(doc)
+	if err != nil {
+		return "", err
+	}
+
+	for _, m := range matches {
+		if m.topicName == topicName {
+			return m.rule.extract(doc)
+		}
+	}
+
+	unsuffixed := strings.TrimSuffix(topicName, zephyr.FIFOSuffix)
+	for _, m := range matches {
+		if strings.TrimSuffix(m.topicName, zephyr.FIFOSuffix) == unsuffixed {
+			return m.rule.extract(doc)
+		}
+	}
+
+	return "", ErrNoMatch
+}
+
+// ExtractMessage publishes the projection of the first matching rule
+func (r *Router) ExtractMessage(record zephyr.Record) (string, error) {
+	doc := Document(record)
+
+	matches, err := r.matches(doc)
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", ErrNoMatch
+	}
+
+	return matches[0].rule.extract(doc)
+}
+
+func (r rule) topicName(doc map[string]interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	for _, seg := range r.topic {
+		if seg.expr == nil {
+			buf.WriteString(seg.literal)
+			continue
+		}
+
+		v, err := seg.expr.Search(doc)
+		if err != nil {
+			return "", err
+		}
+
+		switch value := v.(type) {
+		case nil:
+			return "", ErrEmptyTopic
+		case string:
+			buf.WriteString(value)
+		default:
+			fmt.Fprint(buf, value)
+		}
+	}
+
+	if buf.Len() == 0 {
+		return "", ErrEmptyTopic
+	}
+	return buf.String(), nil
+}
+
+func (r rule) extract(doc map[string]interface{}) (string, error) {
+	var v interface{} = doc
+	if r.message != nil {
+		projection, err := r.message.Search(doc)
+		if err != nil {
+			return "", fmt.Errorf("rule %v: %v", r.name, err)
+		}
+		v = projection
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// truthy follows the JMESPath definition; false, null and empty values are false
+func truthy(v interface{}) bool {
+	switch value := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return value
+	case string:
+		return value != ""
+	case []interface{}:
+		return len(value) > 0
+	case map[string]interface{}:
+		return len(value) > 0
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Map:
+			return rv.Len() > 0
+		}
+		return true
+	}
+}
+
+// parseTopic splits a topic template into literals and {expr} fields
+func parseTopic(topic string) ([]segment, error) {
+	var segments []segment
+
+	for topic != "" {
+		start := strings.Index(topic, "{")
+		if start == -1 {
+			segments = append(segments, segment{literal: topic})
+			break
+		}
+		if start > 0 {
+			segments = append(segments, segment{literal: topic[:start]})
+		}
+
+		depth, end := 0, -1
+		for i := start; i < len(topic) && end == -1; i++ {
+			switch topic[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end == -1 {
+			return nil, ErrUnterminatedField
+		}
+
+		expr, err := jmespath.Compile(topic[start+1 : end])
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment{expr: expr})
+
+		topic = topic[end+1:]
+	}
+
+	return segments, nil
+}
+
+// New compiles the rules in cfg
+func New(cfg Config) (*Router, error) {
+	router := &Router{}
+
+	switch cfg.Match {
+	case "", MatchFirst:
+	case MatchAll:
+		router.matchAll = true
+	default:
+		return nil, ErrInvalidMatch
+	}
+
+	for i, r := range cfg.Rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%v", i)
+		}
+
+		if r.Topic == "" {
+			return nil, fmt.Errorf("rule %v: %v", name, ErrMissingTopic)
+		}
+
+		compiled := rule{name: name}
+
+		topic, err := parseTopic(r.Topic)
+		if err != nil {
+			return nil, fmt.Errorf("rule %v: topic: %v", name, err)
+		}
+		compiled.topic = topic
+
+		if r.Condition != "" {
+			compiled.condition, err = jmespath.Compile(r.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("rule %v: condition: %v", name, err)
+			}
+		}
+
+		if r.Message != "" {
+			compiled.message, err = jmespath.Compile(r.Message)
+			if err != nil {
+				return nil, fmt.Errorf("rule %v: message: %v", name, err)
+			}
+		}
+
+		router.rules = append(router.rules, compiled)
+	}
+
+	return router, nil
+}
+
+// Parse compiles rules from JSON or, when isYAML is set, YAML
+func Parse(data []byte, isYAML bool) (*Router, error) {
+	var cfg Config
+
+	var err error
+	if isYAML {
+		err = yaml.Unmarshal(data, &cfg)
+	} else {
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return New(cfg)
+}
+
+// Load compiles the rules file; files ending in .yaml or .yml are parsed as YAML,
+// everything else as JSON
+func Load(filename string) (*Router, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	return Parse(data, ext == ".yaml" || ext == ".yml")
+}
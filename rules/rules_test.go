@@ -0,0 +1,198 @@
+package rules_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zap"
+	"github.com/savaki/zephyr"
+	"github.com/savaki/zephyr/rules"
+)
+
+func record(eventName, oldState, newState string) zephyr.Record {
+	r := zephyr.Record{
+		EventName:      eventName,
+		EventSourceARN: "arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/label",
+		Dynamodb: zephyr.StreamRecord{
+			Keys: map[string]zephyr.AttributeValue{"id": {S: aws.String("123")}},
+			NewImage: map[string]zephyr.AttributeValue{
+				"id":    {S: aws.String("123")},
+				"state": {S: aws.String(newState)},
+				"total": {N: aws.String("250")},
+			},
+		},
+	}
+	if oldState != "" {
+		r.Dynamodb.OldImage = map[string]zephyr.AttributeValue{
+			"id":    {S: aws.String("123")},
+			"state": {S: aws.String(oldState)},
+		}
+	}
+	return r
+}
+
+func TestRouter(t *testing.T) {
+	cfg := rules.Config{
+		Match: rules.MatchAll,
+		Rules: []rules.Rule{
+			{
+				Name:      "state",
+				Condition: "newImage.state != oldImage.state",
+				Topic:     "{tableName}-{newImage.state}",
+				Message:   "{id: keys.id, state: newImage.state}",
+			},
+			{
+				Name:      "large",
+				Condition: "newImage.total > `100`",
+				Topic:     "{tableName}-large",
+			},
+			{
+				Name:  "audit",
+				Topic: "audit",
+			},
+		},
+	}
+
+	router, err := rules.New(cfg)
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	testCases := map[string]struct {
+		Record     zephyr.Record
+		TopicNames []string
+	}{
+		"changed": {
+			Record:     record(zephyr.Modify, "open", "closed"),
+			TopicNames: []string{"orders-closed", "orders-large", "audit"},
+		},
+		"unchanged": {
+			Record:     record(zephyr.Modify, "open", "open"),
+			TopicNames: []string{"orders-large", "audit"},
+		},
+	}
+
+	for label, tc := range testCases {
+		topicNames, err := router.TopicNames(tc.Record)
+		if err != nil {
+			t.Errorf("%v: expected nil error; got %v", label, err)
+		}
+		if !reflect.DeepEqual(topicNames, tc.TopicNames) {
+			t.Errorf("%v: expected %v; got %v", label, tc.TopicNames, topicNames)
+		}
+	}
+
+	message, err := router.ExtractTopicMessage("orders-closed", record(zephyr.Modify, "open", "closed"))
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if expected := `{"id":"123","state":"closed"}`; message != expected {
+		t.Errorf("expected %v; got %v", expected, message)
+	}
+}
+
+func TestRouterMatchFirst(t *testing.T) {
+	router, err := rules.New(rules.Config{
+		Rules: []rules.Rule{
+			{Condition: "eventName == 'INSERT'", Topic: "created"},
+			{Topic: "other"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	topicNames, _ := router.TopicNames(record(zephyr.Insert, "", "open"))
+	if !reflect.DeepEqual(topicNames, []string{"created"}) {
+		t.Errorf("expected [created]; got %v", topicNames)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"rules.json": `{"match": "all", "rules": [{"condition": "eventName == 'REMOVE'", "topic": "{tableName}-deleted"}]}`,
+		"rules.yaml": "match: all\nrules:\n  - condition: eventName == 'REMOVE'\n    topic: \"{tableName}-deleted\"\n",
+	}
+
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		router, err := rules.Load(filename)
+		if err != nil {
+			t.Errorf("%v: expected nil error; got %v", name, err)
+			continue
+		}
+
+		topicNames, _ := router.TopicNames(record(zephyr.Remove, "open", "open"))
+		if !reflect.DeepEqual(topicNames, []string{"orders-deleted"}) {
+			t.Errorf("%v: expected [orders-deleted]; got %v", name, topicNames)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	testCases := map[string]rules.Config{
+		"match":     {Match: "some", Rules: []rules.Rule{{Topic: "a"}}},
+		"topic":     {Rules: []rules.Rule{{Condition: "a"}}},
+		"condition": {Rules: []rules.Rule{{Condition: "a ==", Topic: "a"}}},
+		"template":  {Rules: []rules.Rule{{Topic: "{tableName"}}},
+	}
+
+	for label, cfg := range testCases {
+		if _, err := rules.New(cfg); err == nil {
+			t.Errorf("%v: expected error; got nil", label)
+		}
+	}
+}
+
+func TestRouterFIFOTopics(t *testing.T) {
+	router, err := rules.Parse([]byte(`{"rules":[{"topic":"{tableName}-{newImage.state}","message":"{state: newImage.state}"}]}`), false)
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+
+	event, _ := json.Marshal(zephyr.Records{Records: []zephyr.Record{record(zephyr.Modify, "open", "closed")}})
+	published := map[string]string{}
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithPartialBatchResponse(),
+		zephyr.WithHandler(router),
+		zephyr.WithFIFOTopics(),
+		zephyr.WithPublishMessageFunc(func(logger zap.Logger, topicArn *string, message zephyr.Message) error {
+			published[*topicArn] = message.Body
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	v, err := handler.Handle(event, nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if failures := v.(*zephyr.BatchResponse).BatchItemFailures; len(failures) != 0 {
+		t.Errorf("expected no failures; got %v", failures)
+	}
+	if expected := `{"state":"closed"}`; published["orders-closed.fifo"] != expected {
+		t.Errorf("expected %v; got %v", expected, published)
+	}
+}
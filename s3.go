@@ -0,0 +1,130 @@
+package zephyr
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol/rest"
+	"github.com/aws/aws-sdk-go/private/signer/v4"
+)
+
+// s3Client is a minimal, path style, S3 client built on the aws-sdk-go core; zephyr
+// only needs PutObject and GetObject so the full service package is not vendored
+type s3Client struct {
+	*client.Client
+}
+
+func newS3Client(p client.ConfigProvider, cfgs ...*aws.Config) *s3Client {
+	c := p.ClientConfig("s3", cfgs...)
+
+	svc := &s3Client{
+		Client: client.New(
+			*c.Config,
+			metadata.ClientInfo{
+				ServiceName:   "s3",
+				SigningRegion: c.SigningRegion,
+				Endpoint:      c.Endpoint,
+				APIVersion:    "2006-03-01",
+			},
+			c.Handlers,
+		),
+	}
+
+	svc.Handlers.Sign.PushBack(v4.Sign)
+	svc.Handlers.Build.PushBackNamed(rest.BuildHandler)
+	svc.Handlers.Unmarshal.PushBackNamed(rest.UnmarshalHandler)
+	svc.Handlers.UnmarshalMeta.PushBackNamed(rest.UnmarshalMetaHandler)
+	svc.Handlers.UnmarshalError.PushBack(unmarshalS3Error)
+
+	return svc
+}
+
+func unmarshalS3Error(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+
+	var v struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(r.HTTPResponse.Body).Decode(&v) // HEAD and some 404s have no body
+
+	if v.Code == "" {
+		v.Code = strings.Replace(http.StatusText(r.HTTPResponse.StatusCode), " ", "", -1)
+	}
+
+	r.Error = awserr.NewRequestFailure(awserr.New(v.Code, v.Message, nil), r.HTTPResponse.StatusCode, r.RequestID)
+}
+
+type putObjectInput struct {
+	_ struct{} `type:"structure" payload:"Body"`
+
+	Body []byte `type:"blob"`
+
+	Bucket *string `location:"uri" locationName:"Bucket" type:"string" required:"true"`
+
+	ContentType *string `location:"header" locationName:"Content-Type" type:"string"`
+
+	Key *string `location:"uri" locationName:"Key" type:"string" required:"true"`
+}
+
+type putObjectOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+type getObjectInput struct {
+	_ struct{} `type:"structure"`
+
+	Bucket *string `location:"uri" locationName:"Bucket" type:"string" required:"true"`
+
+	Key *string `location:"uri" locationName:"Key" type:"string" required:"true"`
+}
+
+type getObjectOutput struct {
+	_ struct{} `type:"structure" payload:"Body"`
+
+	Body []byte `type:"blob"`
+}
+
+func (c *s3Client) PutObject(bucket, key, contentType string, data []byte) error {
+	op := &request.Operation{
+		Name:       "PutObject",
+		HTTPMethod: "PUT",
+		HTTPPath:   "/{Bucket}/{Key+}",
+	}
+
+	input := &putObjectInput{
+		Body:        data,
+		Bucket:      aws.String(bucket),
+		ContentType: aws.String(contentType),
+		Key:         aws.String(key),
+	}
+
+	return c.NewRequest(op, input, &putObjectOutput{}).Send()
+}
+
+func (c *s3Client) GetObject(bucket, key string) ([]byte, error) {
+	op := &request.Operation{
+		Name:       "GetObject",
+		HTTPMethod: "GET",
+		HTTPPath:   "/{Bucket}/{Key+}",
+	}
+
+	input := &getObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	output := &getObjectOutput{}
+	err := c.NewRequest(op, input, output).Send()
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Body, nil
+}
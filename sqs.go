@@ -0,0 +1,70 @@
+package zephyr
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+	"github.com/aws/aws-sdk-go/private/signer/v4"
+)
+
+// sqsClient is a minimal SQS client built on the aws-sdk-go core; zephyr only
+// needs SendMessage so the full service package is not vendored
+type sqsClient struct {
+	*client.Client
+}
+
+func newSQSClient(p client.ConfigProvider, cfgs ...*aws.Config) *sqsClient {
+	c := p.ClientConfig("sqs", cfgs...)
+
+	svc := &sqsClient{
+		Client: client.New(
+			*c.Config,
+			metadata.ClientInfo{
+				ServiceName:   "sqs",
+				SigningRegion: c.SigningRegion,
+				Endpoint:      c.Endpoint,
+				APIVersion:    "2012-11-05",
+			},
+			c.Handlers,
+		),
+	}
+
+	svc.Handlers.Sign.PushBack(v4.Sign)
+	svc.Handlers.Build.PushBackNamed(query.BuildHandler)
+	svc.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	svc.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	svc.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+
+	return svc
+}
+
+type sendMessageInput struct {
+	_ struct{} `type:"structure"`
+
+	MessageBody *string `type:"string" required:"true"`
+
+	QueueUrl *string `type:"string" required:"true"`
+}
+
+type sendMessageOutput struct {
+	_ struct{} `type:"structure"`
+
+	MessageId *string `type:"string"`
+}
+
+func (c *sqsClient) SendMessage(queueURL, body string) error {
+	op := &request.Operation{
+		Name:       "SendMessage",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+
+	input := &sendMessageInput{
+		MessageBody: aws.String(body),
+		QueueUrl:    aws.String(queueURL),
+	}
+
+	return c.NewRequest(op, input, &sendMessageOutput{}).Send()
+}
@@ -25,6 +25,9 @@ const (
 
 type Handler struct {
 	Key string
+
+	// Deleted is the topic REMOVE events are published to; REMOVE events are ignored when empty
+	Deleted string
 }
 
 func (h *Handler) TopicName(record zephyr.Record) (string, error) {
@@ -39,12 +42,18 @@ func (h *Handler) TopicName(record zephyr.Record) (string, error) {
 		if newOk && (!oldOk || newState != oldState) {
 			return TopicName(record.Dynamodb.NewImage, h.Key)
 		}
+
+	case zephyr.Remove:
+		return h.Deleted, nil
 	}
 
 	return "", nil
 }
 
 func (h *Handler) ExtractMessage(record zephyr.Record) (string, error) {
+	if record.EventName == zephyr.Remove {
+		return zephyr.OldImageMessage(record)
+	}
 	return unmarshal(record.Dynamodb.NewImage, h.Key)
 }
 
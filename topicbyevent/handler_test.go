@@ -16,3 +16,34 @@ func TestHandlerInterfaces(t *testing.T) {
 		t.Error("expected Handler to implement zephyr.MessageExtractor")
 	}
 }
+
+func TestHandlerRemove(t *testing.T) {
+	h := New("event")
+	h.Deleted = "orders-deleted"
+
+	state := "closed"
+	r := zephyr.Record{
+		EventName: zephyr.Remove,
+		Dynamodb: zephyr.StreamRecord{
+			OldImage: map[string]zephyr.AttributeValue{
+				"state": {S: &state},
+			},
+		},
+	}
+
+	topicName, err := h.TopicName(r)
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if topicName != h.Deleted {
+		t.Errorf("expected %v; got %v", h.Deleted, topicName)
+	}
+
+	message, err := h.ExtractMessage(r)
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if expected := `{"state":{"S":"closed"}}`; message != expected {
+		t.Errorf("expected %v; got %v", expected, message)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/savaki/zephyr"
 )
 
@@ -13,7 +14,7 @@ var (
 	ErrInvalidARN      = errors.New("Invalid arn format")
 	ErrStateNotFound   = errors.New("Item has no state attribute")
 	ErrStateNotString  = errors.New("State attribute not of string type")
-	ErrStateNotChanged = errors.New("State record was not updated")
+	ErrStateNotChanged = errors.New("State record was not updated") // no longer returned by TopicName
 )
 
 type Record struct {
@@ -22,8 +23,31 @@ type Record struct {
 	OldImage map[string]zephyr.AttributeValue
 }
 
+const (
+	AttributeOldState = "oldState"
+	AttributeNewState = "newState"
+)
+
+const (
+	// DefaultDeleted is the topic suffix used for REMOVE events when Handler.Deleted is empty
+	DefaultDeleted = "deleted"
+)
+
+// PlainRecord is the message published when Handler.Plain is set
+type PlainRecord struct {
+	Keys     map[string]interface{}
+	NewImage map[string]interface{}
+	OldImage map[string]interface{}
+}
+
 type Handler struct {
 	State string
+
+	// Deleted is the suffix of the topic REMOVE events are published to, <table>-<deleted>
+	Deleted string
+
+	// Plain publishes images as natural JSON rather than DynamoDB's typed JSON
+	Plain bool
 }
 
 func (h *Handler) IdentifyEnv(record zephyr.Record) (string, bool) {
@@ -31,7 +55,7 @@ func (h *Handler) IdentifyEnv(record zephyr.Record) (string, bool) {
 }
 
 func (h *Handler) TopicName(record zephyr.Record) (string, error) {
-	if record.EventName != zephyr.Insert && record.EventName != zephyr.Modify {
+	if record.EventName != zephyr.Insert && record.EventName != zephyr.Modify && record.EventName != zephyr.Remove {
 		return "", nil
 	}
 
@@ -42,6 +66,14 @@ func (h *Handler) TopicName(record zephyr.Record) (string, error) {
 
 	fqTableName := segments[1]
 
+	if record.EventName == zephyr.Remove {
+		deleted := h.Deleted
+		if deleted == "" {
+			deleted = DefaultDeleted
+		}
+		return fmt.Sprintf("%v-%v", fqTableName, deleted), nil
+	}
+
 	newState, err := State(h.State, record.Dynamodb.NewImage)
 	if err != nil {
 		return "", err
@@ -59,18 +91,40 @@ func (h *Handler) TopicName(record zephyr.Record) (string, error) {
 	}
 
 	if newState == oldState {
-		return "", ErrStateNotChanged
+		// not an error; records whose state did not change are simply not routed
+		return "", nil
 	}
 
 	return topicName, nil
 }
 
+// MessageAttributes adds the old and new state so subscribers may filter on transitions
+func (h *Handler) MessageAttributes(record zephyr.Record) (map[string]*sns.MessageAttributeValue, error) {
+	attributes := map[string]*sns.MessageAttributeValue{}
+
+	if state, err := State(h.State, record.Dynamodb.OldImage); err == nil {
+		attributes[AttributeOldState] = zephyr.StringAttribute(state)
+	}
+	if state, err := State(h.State, record.Dynamodb.NewImage); err == nil {
+		attributes[AttributeNewState] = zephyr.StringAttribute(state)
+	}
+
+	return attributes, nil
+}
+
 func (h *Handler) ExtractMessage(record zephyr.Record) (string, error) {
-	r := Record{
+	var r interface{} = Record{
 		Keys:     record.Dynamodb.Keys,
 		NewImage: record.Dynamodb.NewImage,
 		OldImage: record.Dynamodb.OldImage,
 	}
+	if h.Plain {
+		r = PlainRecord{
+			Keys:     zephyr.PlainImage(record.Dynamodb.Keys),
+			NewImage: zephyr.PlainImage(record.Dynamodb.NewImage),
+			OldImage: zephyr.PlainImage(record.Dynamodb.OldImage),
+		}
+	}
 
 	data, err := json.Marshal(r)
 	if err != nil {
@@ -82,7 +136,8 @@ func (h *Handler) ExtractMessage(record zephyr.Record) (string, error) {
 
 func New(state string) zephyr.TopicNamer {
 	return &Handler{
-		State: state,
+		State:   state,
+		Deleted: DefaultDeleted,
 	}
 }
 
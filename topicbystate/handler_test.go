@@ -23,3 +23,57 @@ func TestIdentifyEnv(t *testing.T) {
 		t.Errorf("expected tracy; got %v", env)
 	}
 }
+
+func TestTopicNameRemove(t *testing.T) {
+	r := zephyr.Record{
+		EventName:      zephyr.Remove,
+		EventSourceARN: "arn:aws:dynamodb:us-east-1:554068800329:table/rewards-tracy-orders/stream/2016-05-16T22:22:50.550",
+	}
+
+	topicName, err := topicbystate.New("state").TopicName(r)
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if topicName != "rewards-tracy-orders-deleted" {
+		t.Errorf("expected rewards-tracy-orders-deleted; got %v", topicName)
+	}
+}
+
+func TestMessageAttributes(t *testing.T) {
+	oldState, newState := "open", "closed"
+	r := zephyr.Record{
+		EventName: zephyr.Modify,
+		Dynamodb: zephyr.StreamRecord{
+			OldImage: map[string]zephyr.AttributeValue{"state": {S: &oldState}},
+			NewImage: map[string]zephyr.AttributeValue{"state": {S: &newState}},
+		},
+	}
+
+	attributes, err := (&topicbystate.Handler{State: "state"}).MessageAttributes(r)
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if v := *attributes[topicbystate.AttributeOldState].StringValue; v != oldState {
+		t.Errorf("expected %v; got %v", oldState, v)
+	}
+	if v := *attributes[topicbystate.AttributeNewState].StringValue; v != newState {
+		t.Errorf("expected %v; got %v", newState, v)
+	}
+}
+
+func TestExtractMessagePlain(t *testing.T) {
+	state := "open"
+	r := zephyr.Record{
+		Dynamodb: zephyr.StreamRecord{
+			NewImage: map[string]zephyr.AttributeValue{"state": {S: &state}},
+		},
+	}
+
+	message, err := (&topicbystate.Handler{State: "state", Plain: true}).ExtractMessage(r)
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if expected := `{"Keys":null,"NewImage":{"state":"open"},"OldImage":null}`; message != expected {
+		t.Errorf("expected %v; got %v", expected, message)
+	}
+}
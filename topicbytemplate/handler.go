@@ -0,0 +1,132 @@
+package topicbytemplate
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/savaki/zephyr"
+)
+
+var (
+	ErrAttributeNotFound = errors.New("zephyr:topicbytemplate:err:attribute_not_found")
+	ErrAttributeNotValue = errors.New("zephyr:topicbytemplate:err:attribute_not_value")
+)
+
+// Data is available to topic name templates
+type Data struct {
+	TableName string
+	Env       string
+	EventName string
+	Keys      map[string]zephyr.AttributeValue
+	NewImage  map[string]zephyr.AttributeValue
+	OldImage  map[string]zephyr.AttributeValue
+	Record    zephyr.Record
+}
+
+// Funcs are the helper functions available to topic name templates
+var Funcs = template.FuncMap{
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"sanitize": Sanitize,
+	"attr":     attr,
+	"default":  defaultValue,
+}
+
+// Handler names topics by executing a text/template against Data, e.g.
+//
+//	{{.TableName}}-{{attr .NewImage "state" | lower}}
+//
+// Within templates attr renders a missing attribute as "", so default can supply a
+// fallback, e.g. {{attr .OldImage "state" | default "new"}}.  A template that renders an
+// empty string skips the record.
+type Handler struct {
+	// Env, when set, provides Data.Env
+	Env zephyr.EnvIdentifier
+
+	tmpl *template.Template
+}
+
+func (h *Handler) TopicName(record zephyr.Record) (string, error) {
+	data := Data{
+		EventName: record.EventName,
+		Keys:      record.Dynamodb.Keys,
+		NewImage:  record.Dynamodb.NewImage,
+		OldImage:  record.Dynamodb.OldImage,
+		Record:    record,
+	}
+	data.TableName, _ = zephyr.TableName(record)
+	if h.Env != nil {
+		data.Env, _ = h.Env.IdentifyEnv(record)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := h.tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func New(text string) (*Handler, error) {
+	tmpl, err := template.New("topic").Funcs(Funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{
+		tmpl: tmpl,
+	}, nil
+}
+
+// Sanitize replaces characters SNS does not allow in topic names with -
+func Sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '-'
+		}
+	}, s)
+}
+
+// Attr returns the value at path, such as profile.tier or items[0].sku, rendered as a
+// string; see zephyr.LookupAttribute for the path syntax
+func Attr(item map[string]zephyr.AttributeValue, path string) (string, error) {
+	av, ok := zephyr.LookupAttribute(item, path)
+	if !ok {
+		return "", ErrAttributeNotFound
+	}
+
+	switch {
+	case av.S != nil:
+		return *av.S, nil
+	case av.N != nil:
+		return *av.N, nil
+	case av.BOOL != nil:
+		return strconv.FormatBool(*av.BOOL), nil
+	case av.NULL != nil:
+		return "", nil
+	default:
+		return "", ErrAttributeNotValue
+	}
+}
+
+// attr is Attr for templates; a missing attribute renders as "" rather than failing
+func attr(item map[string]zephyr.AttributeValue, path string) (string, error) {
+	v, err := Attr(item, path)
+	if err == ErrAttributeNotFound {
+		return "", nil
+	}
+	return v, err
+}
+
+func defaultValue(fallback, value string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
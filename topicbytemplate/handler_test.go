@@ -0,0 +1,76 @@
+package topicbytemplate_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zephyr"
+	"github.com/savaki/zephyr/topicbystate"
+	"github.com/savaki/zephyr/topicbytemplate"
+)
+
+func TestTopicName(t *testing.T) {
+	r := zephyr.Record{
+		EventName:      zephyr.Modify,
+		EventSourceARN: "arn:aws:dynamodb:us-east-1:554068800329:table/rewards-tracy-orders/stream/2016-05-16T22:22:50.550",
+		Dynamodb: zephyr.StreamRecord{
+			NewImage: map[string]zephyr.AttributeValue{
+				"state": {S: aws.String("Awaiting Payment")},
+				"profile": {M: map[string]zephyr.AttributeValue{
+					"tier": {S: aws.String("GOLD")},
+				}},
+			},
+		},
+	}
+
+	testCases := map[string]string{
+		`{{.TableName}}-{{attr .NewImage "state" | sanitize | lower}}`:    "rewards-tracy-orders-awaiting-payment",
+		`{{.Env}}-{{attr .NewImage "profile.tier" | lower}}`:              "tracy-gold",
+		`{{.EventName | lower}}-{{attr .OldImage "state" | default "x"}}`: "modify-x",
+		`{{attr .NewImage "missing"}}`:                                    "",
+		`{{if eq .EventName "REMOVE"}}deleted{{end}}`:                     "",
+	}
+
+	for text, expected := range testCases {
+		h, err := topicbytemplate.New(text)
+		if err != nil {
+			t.Fatalf("%v: expected nil error; got %v", text, err)
+		}
+		h.Env = zephyr.EnvIdentifierFunc(topicbystate.IdentifyEnv)
+
+		topicName, err := h.TopicName(r)
+		if err != nil {
+			t.Errorf("%v: expected nil error; got %v", text, err)
+		}
+		if topicName != expected {
+			t.Errorf("%v: expected %v; got %v", text, expected, topicName)
+		}
+	}
+}
+
+func TestAttr(t *testing.T) {
+	item := map[string]zephyr.AttributeValue{
+		"items": {L: []zephyr.AttributeValue{
+			{M: map[string]zephyr.AttributeValue{"sku": {S: aws.String("abc")}}},
+		}},
+		"total": {N: aws.String("12.50")},
+	}
+
+	testCases := map[string]string{
+		"items.0.sku":  "abc",
+		"items[0].sku": "abc",
+		"total":        "12.50",
+	}
+	for path, expected := range testCases {
+		v, err := topicbytemplate.Attr(item, path)
+		if err != nil || v != expected {
+			t.Errorf("%v: expected %v; got %v, %v", path, expected, v, err)
+		}
+	}
+
+	for _, path := range []string{"missing", "items.1.sku", "items.0.price"} {
+		if _, err := topicbytemplate.Attr(item, path); err != topicbytemplate.ErrAttributeNotFound {
+			t.Errorf("%v: expected ErrAttributeNotFound; got %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package zephyr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// MaskValue replaces attributes redacted by Mask
+const MaskValue = "****"
+
+// ---- Transform ---------------------------------------------------------------
+
+type TransformImageFunc func(item map[string]AttributeValue) map[string]AttributeValue
+
+func (fn TransformImageFunc) TransformImage(item map[string]AttributeValue) map[string]AttributeValue {
+	return fn(item)
+}
+
+// Transform rewrites the Keys, NewImage and OldImage of a record before its message is
+// extracted.  Implementations receive a copy and may modify it in place.
+type Transform interface {
+	TransformImage(item map[string]AttributeValue) map[string]AttributeValue
+}
+
+// Transforms applies each transform in order
+func Transforms(transforms ...Transform) TransformImageFunc {
+	return func(item map[string]AttributeValue) map[string]AttributeValue {
+		for _, transform := range transforms {
+			item = transform.TransformImage(item)
+		}
+		return item
+	}
+}
+
+// Drop removes the attributes at paths.  Paths use the syntax LookupAttribute accepts;
+// a * segment matches every key or index, e.g. contacts.*.phone or contacts[*].phone.
+func Drop(paths ...string) TransformImageFunc {
+	return func(item map[string]AttributeValue) map[string]AttributeValue {
+		for _, p := range paths {
+			removePath(item, splitPath(p))
+		}
+		return item
+	}
+}
+
+// Mask replaces the attributes at paths with MaskValue
+func Mask(paths ...string) TransformImageFunc {
+	return Replace(func(AttributeValue) AttributeValue {
+		return AttributeValue{S: strPtr(MaskValue)}
+	}, paths...)
+}
+
+// HMAC replaces the attributes at paths with the hex encoded HMAC-SHA256 of their
+// value, so equal values can still be correlated without being revealed.  Strings and
+// numbers are hashed as is; other values are hashed as natural JSON.
+func HMAC(key []byte, paths ...string) TransformImageFunc {
+	return Replace(func(av AttributeValue) AttributeValue {
+		var data []byte
+		switch {
+		case av.S != nil:
+			data = []byte(*av.S)
+		case av.N != nil:
+			data = []byte(*av.N)
+		default:
+			data, _ = json.Marshal(PlainValue(av))
+		}
+
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return AttributeValue{S: strPtr(hex.EncodeToString(mac.Sum(nil)))}
+	}, paths...)
+}
+
+// Replace rewrites the attributes at paths with fn
+func Replace(fn func(AttributeValue) AttributeValue, paths ...string) TransformImageFunc {
+	return func(item map[string]AttributeValue) map[string]AttributeValue {
+		for _, p := range paths {
+			replacePath(item, splitPath(p), fn)
+		}
+		return item
+	}
+}
+
+// Project keeps only the attributes at paths, along with the maps and lists that
+// contain them, and drops everything else
+func Project(paths ...string) TransformImageFunc {
+	return func(item map[string]AttributeValue) map[string]AttributeValue {
+		if item == nil {
+			return nil
+		}
+
+		projected := map[string]AttributeValue{}
+		for _, p := range paths {
+			projectPath(item, projected, splitPath(p))
+		}
+		return projected
+	}
+}
+
+func removePath(item map[string]AttributeValue, segments []string) {
+	for _, key := range matchingKeys(item, segments[0]) {
+		if len(segments) == 1 {
+			delete(item, key)
+			continue
+		}
+
+		av := item[key]
+		removeValuePath(&av, segments[1:])
+		item[key] = av
+	}
+}
+
+func removeValuePath(av *AttributeValue, segments []string) {
+	switch {
+	case av.M != nil:
+		removePath(av.M, segments)
+
+	case av.L != nil:
+		indexes := matchingIndexes(av.L, segments[0])
+		if len(segments) > 1 {
+			for _, i := range indexes {
+				removeValuePath(&av.L[i], segments[1:])
+			}
+			return
+		}
+
+		list := av.L[:0]
+		for i, item := range av.L {
+			if !containsIndex(indexes, i) {
+				list = append(list, item)
+			}
+		}
+		av.L = list
+	}
+}
+
+func replacePath(item map[string]AttributeValue, segments []string, fn func(AttributeValue) AttributeValue) {
+	for _, key := range matchingKeys(item, segments[0]) {
+		av := item[key]
+		replaceValuePath(&av, segments[1:], fn)
+		item[key] = av
+	}
+}
+
+func replaceValuePath(av *AttributeValue, segments []string, fn func(AttributeValue) AttributeValue) {
+	switch {
+	case len(segments) == 0:
+		*av = fn(*av)
+	case av.M != nil:
+		replacePath(av.M, segments, fn)
+	case av.L != nil:
+		for _, i := range matchingIndexes(av.L, segments[0]) {
+			replaceValuePath(&av.L[i], segments[1:], fn)
+		}
+	}
+}
+
+func projectPath(item, projected map[string]AttributeValue, segments []string) {
+	for _, key := range matchingKeys(item, segments[0]) {
+		if len(segments) == 1 {
+			projected[key] = item[key]
+			continue
+		}
+
+		av, ok := projectValuePath(item[key], projected[key], segments[1:])
+		if ok {
+			projected[key] = av
+		}
+	}
+}
+
+// projectValuePath merges the parts of av at segments into target; lists keep the
+// positions of their projected elements
+func projectValuePath(av, target AttributeValue, segments []string) (AttributeValue, bool) {
+	switch {
+	case av.M != nil:
+		if target.M == nil {
+			target = AttributeValue{M: map[string]AttributeValue{}}
+		}
+		projectPath(av.M, target.M, segments)
+		return target, len(target.M) > 0
+
+	case av.L != nil:
+		if target.L == nil {
+			target = AttributeValue{L: make([]AttributeValue, len(av.L))}
+			for i := range target.L {
+				target.L[i] = AttributeValue{NULL: boolPtr(true)}
+			}
+		}
+		found := false
+		for _, i := range matchingIndexes(av.L, segments[0]) {
+			if len(segments) == 1 {
+				target.L[i] = av.L[i]
+				found = true
+				continue
+			}
+
+			current := target.L[i]
+			if current.NULL != nil {
+				current = AttributeValue{}
+			}
+			if projected, ok := projectValuePath(av.L[i], current, segments[1:]); ok {
+				target.L[i] = projected
+				found = true
+			}
+		}
+		return target, found
+
+	default:
+		return target, false
+	}
+}
+
+func matchingKeys(item map[string]AttributeValue, segment string) []string {
+	if segment != "*" {
+		if _, ok := item[segment]; ok {
+			return []string{segment}
+		}
+		return nil
+	}
+
+	keys := make([]string, 0, len(item))
+	for key := range item {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func matchingIndexes(list []AttributeValue, segment string) []int {
+	if segment == "*" {
+		indexes := make([]int, len(list))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes
+	}
+
+	i, err := strconv.Atoi(segment)
+	if err != nil || i < 0 || i >= len(list) {
+		return nil
+	}
+	return []int{i}
+}
+
+func containsIndex(indexes []int, i int) bool {
+	for _, index := range indexes {
+		if index == i {
+			return true
+		}
+	}
+	return false
+}
+
+// copyImage deep copies the maps and lists of item so transforms may modify it
+func copyImage(item map[string]AttributeValue) map[string]AttributeValue {
+	if item == nil {
+		return nil
+	}
+
+	copied := make(map[string]AttributeValue, len(item))
+	for k, av := range item {
+		copied[k] = copyValue(av)
+	}
+	return copied
+}
+
+func copyValue(av AttributeValue) AttributeValue {
+	switch {
+	case av.M != nil:
+		av.M = copyImage(av.M)
+	case av.L != nil:
+		list := make([]AttributeValue, len(av.L))
+		for i, item := range av.L {
+			list[i] = copyValue(item)
+		}
+		av.L = list
+	}
+	return av
+}
+
+// ---- Handler -----------------------------------------------------------------
+
+type topicTransform struct {
+	pattern   string
+	transform Transform
+}
+
+// transformRecord returns a copy of record with every transform registered for
+// topicName applied to its images
+func (h *Handler) transformRecord(topicName string, record Record) Record {
+	if h.fifo {
+		topicName = strings.TrimSuffix(topicName, FIFOSuffix)
+	}
+
+	for _, t := range h.transforms {
+		if ok, _ := path.Match(t.pattern, topicName); !ok {
+			continue
+		}
+
+		record.Dynamodb.Keys = t.transform.TransformImage(copyImage(record.Dynamodb.Keys))
+		record.Dynamodb.NewImage = t.transform.TransformImage(copyImage(record.Dynamodb.NewImage))
+		record.Dynamodb.OldImage = t.transform.TransformImage(copyImage(record.Dynamodb.OldImage))
+	}
+	return record
+}
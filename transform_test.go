@@ -0,0 +1,143 @@
+package zephyr_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/savaki/zap"
+	"github.com/savaki/zephyr"
+)
+
+func newCustomer() map[string]zephyr.AttributeValue {
+	return map[string]zephyr.AttributeValue{
+		"id":    {S: aws.String("abc")},
+		"email": {S: aws.String("joe@example.com")},
+		"tier":  {S: aws.String("gold")},
+		"contacts": {L: []zephyr.AttributeValue{
+			{M: map[string]zephyr.AttributeValue{"name": {S: aws.String("ann")}, "phone": {S: aws.String("555-1234")}}},
+			{M: map[string]zephyr.AttributeValue{"name": {S: aws.String("bob")}, "phone": {S: aws.String("555-5678")}}},
+		}},
+	}
+}
+
+func TestTransforms(t *testing.T) {
+	key := []byte("secret")
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("joe@example.com"))
+	hashed := hex.EncodeToString(mac.Sum(nil))
+
+	testCases := map[string]struct {
+		Transform zephyr.Transform
+		Expected  string
+	}{
+		"drop": {
+			Transform: zephyr.Drop("email", "contacts.*.phone"),
+			Expected:  `{"contacts":[{"name":"ann"},{"name":"bob"}],"id":"abc","tier":"gold"}`,
+		},
+		"drop list element": {
+			Transform: zephyr.Drop("contacts.0"),
+			Expected:  `{"contacts":[{"name":"bob","phone":"555-5678"}],"email":"joe@example.com","id":"abc","tier":"gold"}`,
+		},
+		"mask": {
+			Transform: zephyr.Mask("email", "contacts.1.phone", "missing"),
+			Expected:  `{"contacts":[{"name":"ann","phone":"555-1234"},{"name":"bob","phone":"****"}],"email":"****","id":"abc","tier":"gold"}`,
+		},
+		"mask bracket index": {
+			Transform: zephyr.Mask("contacts[1].phone"),
+			Expected:  `{"contacts":[{"name":"ann","phone":"555-1234"},{"name":"bob","phone":"****"}],"email":"joe@example.com","id":"abc","tier":"gold"}`,
+		},
+		"hmac": {
+			Transform: zephyr.HMAC(key, "email"),
+			Expected:  `{"contacts":[{"name":"ann","phone":"555-1234"},{"name":"bob","phone":"555-5678"}],"email":"` + hashed + `","id":"abc","tier":"gold"}`,
+		},
+		"project": {
+			Transform: zephyr.Project("id", "contacts.*.name"),
+			Expected:  `{"contacts":[{"name":"ann"},{"name":"bob"}],"id":"abc"}`,
+		},
+		"pipeline": {
+			Transform: zephyr.Transforms(zephyr.Project("id", "email"), zephyr.Mask("email")),
+			Expected:  `{"email":"****","id":"abc"}`,
+		},
+	}
+
+	for label, tc := range testCases {
+		// When
+		data, err := zephyr.MarshalPlainImage(tc.Transform.TransformImage(newCustomer()))
+
+		// Then
+		if err != nil {
+			t.Errorf("%v: expected nil error; got %v", label, err)
+		}
+		if string(data) != tc.Expected {
+			t.Errorf("%v: expected %v; got %v", label, tc.Expected, string(data))
+		}
+	}
+}
+
+func TestWithTransform(t *testing.T) {
+	record := zephyr.Record{
+		EventName: zephyr.Insert,
+		Dynamodb: zephyr.StreamRecord{
+			Keys:           map[string]zephyr.AttributeValue{"id": {S: aws.String("abc")}},
+			NewImage:       newCustomer(),
+			SequenceNumber: "100",
+		},
+	}
+	event, _ := json.Marshal(zephyr.Records{Records: []zephyr.Record{record}})
+
+	testCases := map[string]struct {
+		Options  []zephyr.Option
+		Internal string
+		Public   string
+	}{
+		"standard": {
+			Internal: "customers-internal",
+			Public:   "customers-public",
+		},
+		"fifo": {
+			Options:  []zephyr.Option{zephyr.WithFIFOTopics()},
+			Internal: "customers-internal.fifo",
+			Public:   "customers-public.fifo",
+		},
+	}
+
+	for label, tc := range testCases {
+		published := map[string]string{}
+
+		// Given
+		opts := append([]zephyr.Option{
+			zephyr.WithTopicNamesFunc(func(record zephyr.Record) ([]string, error) {
+				return []string{"customers-internal", "customers-public"}, nil
+			}),
+			zephyr.WithPlainJSON(),
+			zephyr.WithTransform("customers-public", zephyr.Drop("contacts"), zephyr.Mask("email")),
+			zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+				published[*topicArn] = message
+				return nil
+			}),
+			zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+				return aws.String(topicName), nil
+			}),
+		}, tc.Options...)
+		handler := zephyr.New(opts...)
+
+		// When
+		_, err := handler.Handle(event, nil)
+
+		// Then
+		if err != nil {
+			t.Fatalf("%v: expected nil error; got %v", label, err)
+		}
+		if message := published[tc.Internal]; !strings.Contains(message, "joe@example.com") || !strings.Contains(message, "555-1234") {
+			t.Errorf("%v: expected internal topic to receive the whole image; got %v", label, message)
+		}
+		if message, ok := published[tc.Public]; !ok || strings.Contains(message, "joe@example.com") || strings.Contains(message, "contacts") {
+			t.Errorf("%v: expected public topic to receive the redacted image; got %v", label, message)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package zephyr
 
-import "github.com/savaki/zap"
+import (
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/savaki/zap"
+	"golang.org/x/net/context"
+)
 
 // ---- EnvIdentifier -----------------------------------------------------------
 
@@ -22,10 +26,55 @@ func (fn TopicNameFunc) TopicName(record Record) (string, error) {
 	return fn(record)
 }
 
+func (fn TopicNameFunc) TopicNameContext(ctx context.Context, record Record) (string, error) {
+	return fn(record)
+}
+
 type TopicNamer interface {
 	TopicName(record Record) (string, error)
 }
 
+type TopicNameContextFunc func(ctx context.Context, record Record) (string, error)
+
+func (fn TopicNameContextFunc) TopicNameContext(ctx context.Context, record Record) (string, error) {
+	return fn(ctx, record)
+}
+
+// TopicNamerContext is a TopicNamer that observes the invocation's context; Handler
+// prefers it when both are implemented
+type TopicNamerContext interface {
+	TopicNameContext(ctx context.Context, record Record) (string, error)
+}
+
+type topicNamerContext struct {
+	TopicNamer
+}
+
+func (n topicNamerContext) TopicNameContext(ctx context.Context, record Record) (string, error) {
+	return n.TopicName(record)
+}
+
+func asTopicNamerContext(v TopicNamer) TopicNamerContext {
+	if nc, ok := v.(TopicNamerContext); ok {
+		return nc
+	}
+	return topicNamerContext{v}
+}
+
+// ---- TopicNames --------------------------------------------------------------
+
+type TopicNamesFunc func(record Record) ([]string, error)
+
+func (fn TopicNamesFunc) TopicNames(record Record) ([]string, error) {
+	return fn(record)
+}
+
+// MultiTopicNamer fans a record out to several topics; each topic is looked up and
+// published to independently
+type MultiTopicNamer interface {
+	TopicNames(record Record) ([]string, error)
+}
+
 // ---- TopicArnFinder ----------------------------------------------------------
 
 type FindTopicArnFunc func(topicName string) (*string, error)
@@ -34,10 +83,41 @@ func (fn FindTopicArnFunc) FindTopicArn(topicName string) (*string, error) {
 	return fn(topicName)
 }
 
+func (fn FindTopicArnFunc) FindTopicArnContext(ctx context.Context, topicName string) (*string, error) {
+	return fn(topicName)
+}
+
 type TopicArnFinder interface {
 	FindTopicArn(topicName string) (*string, error)
 }
 
+type FindTopicArnContextFunc func(ctx context.Context, topicName string) (*string, error)
+
+func (fn FindTopicArnContextFunc) FindTopicArnContext(ctx context.Context, topicName string) (*string, error) {
+	return fn(ctx, topicName)
+}
+
+// TopicArnFinderContext is a TopicArnFinder that observes the invocation's context;
+// Handler prefers it when both are implemented
+type TopicArnFinderContext interface {
+	FindTopicArnContext(ctx context.Context, topicName string) (*string, error)
+}
+
+type topicArnFinderContext struct {
+	TopicArnFinder
+}
+
+func (f topicArnFinderContext) FindTopicArnContext(ctx context.Context, topicName string) (*string, error) {
+	return f.FindTopicArn(topicName)
+}
+
+func asTopicArnFinderContext(v TopicArnFinder) TopicArnFinderContext {
+	if fc, ok := v.(TopicArnFinderContext); ok {
+		return fc
+	}
+	return topicArnFinderContext{v}
+}
+
 // ---- MessageExtractor --------------------------------------------------------
 
 type ExtractMessageFunc func(record Record) (string, error)
@@ -46,18 +126,186 @@ func (fn ExtractMessageFunc) ExtractMessage(record Record) (string, error) {
 	return fn(record)
 }
 
+func (fn ExtractMessageFunc) ExtractMessageContext(ctx context.Context, record Record) (string, error) {
+	return fn(record)
+}
+
 type MessageExtractor interface {
 	ExtractMessage(record Record) (string, error)
 }
 
+type ExtractMessageContextFunc func(ctx context.Context, record Record) (string, error)
+
+func (fn ExtractMessageContextFunc) ExtractMessageContext(ctx context.Context, record Record) (string, error) {
+	return fn(ctx, record)
+}
+
+// MessageExtractorContext is a MessageExtractor that observes the invocation's context;
+// Handler prefers it when both are implemented
+type MessageExtractorContext interface {
+	ExtractMessageContext(ctx context.Context, record Record) (string, error)
+}
+
+type messageExtractorContext struct {
+	MessageExtractor
+}
+
+func (e messageExtractorContext) ExtractMessageContext(ctx context.Context, record Record) (string, error) {
+	return e.ExtractMessage(record)
+}
+
+func asMessageExtractorContext(v MessageExtractor) MessageExtractorContext {
+	if ec, ok := v.(MessageExtractorContext); ok {
+		return ec
+	}
+	return messageExtractorContext{v}
+}
+
+// TopicMessageExtractor extracts a message specific to the topic it will be published to.
+// Handler prefers it when the MessageExtractor implements both.
+type TopicMessageExtractor interface {
+	ExtractTopicMessage(topicName string, record Record) (string, error)
+}
+
+// ---- MessageAttributer -------------------------------------------------------
+
+type MessageAttributesFunc func(record Record) (map[string]*sns.MessageAttributeValue, error)
+
+func (fn MessageAttributesFunc) MessageAttributes(record Record) (map[string]*sns.MessageAttributeValue, error) {
+	return fn(record)
+}
+
+// MessageAttributer provides SNS message attributes for a record so subscribers may use
+// filter policies; they are merged over the default attributes zephyr provides
+type MessageAttributer interface {
+	MessageAttributes(record Record) (map[string]*sns.MessageAttributeValue, error)
+}
+
 // ---- Publisher ---------------------------------------------------------------
 
+// Message is what MessagePublishers publish to a topic
+type Message struct {
+	Body       string
+	Attributes map[string]*sns.MessageAttributeValue
+
+	// GroupID and DeduplicationID are only set when publishing to FIFO topics
+	GroupID         string
+	DeduplicationID string
+}
+
 type PublishFunc func(logger zap.Logger, topicArn *string, message string) error
 
 func (fn PublishFunc) Publish(logger zap.Logger, topicArn *string, message string) error {
 	return fn(logger, topicArn, message)
 }
 
+func (fn PublishFunc) PublishContext(ctx context.Context, logger zap.Logger, topicArn *string, message string) error {
+	return fn(logger, topicArn, message)
+}
+
 type Publisher interface {
 	Publish(logger zap.Logger, topicArn *string, message string) error
 }
+
+type PublishContextFunc func(ctx context.Context, logger zap.Logger, topicArn *string, message string) error
+
+func (fn PublishContextFunc) PublishContext(ctx context.Context, logger zap.Logger, topicArn *string, message string) error {
+	return fn(ctx, logger, topicArn, message)
+}
+
+// PublisherContext is a Publisher that observes the invocation's context; Handler
+// prefers it when both are implemented
+type PublisherContext interface {
+	PublishContext(ctx context.Context, logger zap.Logger, topicArn *string, message string) error
+}
+
+// ---- DeadLetterSink ----------------------------------------------------------
+
+type DeadLetterFunc func(record Record, stage string, err error) error
+
+func (fn DeadLetterFunc) DeadLetter(record Record, stage string, err error) error {
+	return fn(record, stage, err)
+}
+
+type DeadLetterSink interface {
+	DeadLetter(record Record, stage string, err error) error
+}
+
+type PublishMessageFunc func(logger zap.Logger, topicArn *string, message Message) error
+
+func (fn PublishMessageFunc) PublishMessage(logger zap.Logger, topicArn *string, message Message) error {
+	return fn(logger, topicArn, message)
+}
+
+func (fn PublishMessageFunc) PublishMessageContext(ctx context.Context, logger zap.Logger, topicArn *string, message Message) error {
+	return fn(logger, topicArn, message)
+}
+
+// MessagePublisher publishes a Message along with its attributes.  A Publisher given to
+// Handler is adapted to a MessagePublisher that publishes only the Body.
+type MessagePublisher interface {
+	PublishMessage(logger zap.Logger, topicArn *string, message Message) error
+}
+
+// messagePublisher adapts a Publisher, which only accepts the message body
+type messagePublisher struct {
+	Publisher
+}
+
+func (p messagePublisher) PublishMessage(logger zap.Logger, topicArn *string, message Message) error {
+	return p.Publish(logger, topicArn, message.Body)
+}
+
+func asMessagePublisher(v Publisher) MessagePublisher {
+	if mp, ok := v.(MessagePublisher); ok {
+		return mp
+	}
+	return messagePublisher{v}
+}
+
+type PublishMessageContextFunc func(ctx context.Context, logger zap.Logger, topicArn *string, message Message) error
+
+func (fn PublishMessageContextFunc) PublishMessageContext(ctx context.Context, logger zap.Logger, topicArn *string, message Message) error {
+	return fn(ctx, logger, topicArn, message)
+}
+
+// MessagePublisherContext is a MessagePublisher that observes the invocation's context;
+// Handler prefers it when implemented
+type MessagePublisherContext interface {
+	PublishMessageContext(ctx context.Context, logger zap.Logger, topicArn *string, message Message) error
+}
+
+// messagePublisherContext adapts a MessagePublisher, which ignores the context
+type messagePublisherContext struct {
+	MessagePublisher
+}
+
+func (p messagePublisherContext) PublishMessageContext(ctx context.Context, logger zap.Logger, topicArn *string, message Message) error {
+	return p.PublishMessage(logger, topicArn, message)
+}
+
+// publisherContext adapts a PublisherContext, which only accepts the message body
+type publisherContext struct {
+	PublisherContext
+}
+
+func (p publisherContext) PublishMessageContext(ctx context.Context, logger zap.Logger, topicArn *string, message Message) error {
+	return p.PublishContext(ctx, logger, topicArn, message.Body)
+}
+
+// asMessagePublisherContext adapts any of the publisher interfaces, preferring the
+// richest one v implements
+func asMessagePublisherContext(v interface{}) MessagePublisherContext {
+	switch p := v.(type) {
+	case MessagePublisherContext:
+		return p
+	case MessagePublisher:
+		return messagePublisherContext{p}
+	case PublisherContext:
+		return publisherContext{p}
+	case Publisher:
+		return messagePublisherContext{asMessagePublisher(p)}
+	default:
+		return nil
+	}
+}
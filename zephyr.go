@@ -2,9 +2,12 @@ package zephyr
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/apex/go-apex"
@@ -12,11 +15,13 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/savaki/zap"
+	"golang.org/x/net/context"
 )
 
 const (
 	Insert = "INSERT"
 	Modify = "MODIFY"
+	Remove = "REMOVE"
 )
 
 type AttributeValue struct {
@@ -33,12 +38,14 @@ type AttributeValue struct {
 }
 
 type StreamRecord struct {
-	Keys           map[string]AttributeValue
-	NewImage       map[string]AttributeValue
-	OldImage       map[string]AttributeValue
-	SequenceNumber string
-	SizeBytes      int64
-	StreamViewType string
+	// ApproximateCreationDateTime is when the change was made, in seconds since the epoch
+	ApproximateCreationDateTime float64 `json:",omitempty"`
+	Keys                        map[string]AttributeValue
+	NewImage                    map[string]AttributeValue
+	OldImage                    map[string]AttributeValue
+	SequenceNumber              string
+	SizeBytes                   int64
+	StreamViewType              string
 }
 
 type Record struct {
@@ -55,21 +62,79 @@ type Records struct {
 	Records []Record `json:"Records"`
 }
 
+// BatchItemFailure identifies a record, by SequenceNumber, that Lambda should retry
+type BatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// BatchResponse is the Lambda partial batch response; only the records listed in
+// BatchItemFailures are retried.  It is returned only when WithPartialBatchResponse is set
+type BatchResponse struct {
+	BatchItemFailures []BatchItemFailure `json:"batchItemFailures"`
+}
+
 type Handler struct {
-	identifier EnvIdentifier
-	namer      TopicNamer
-	finder     TopicArnFinder
-	extractor  MessageExtractor
-	publisher  Publisher
-	topicArns  *cache
-	writer     zap.WriteSyncer
-	log        zap.Logger
-}
-
-func (h *Handler) HandlerFunc(event json.RawMessage, ctx *apex.Context) (interface{}, error) {
-	defer h.log.Info("zephyr:finished")
+	identifier           EnvIdentifier
+	namer                TopicNamerContext
+	multiNamer           MultiTopicNamer
+	attributer           MessageAttributer
+	finder               TopicArnFinderContext
+	extractor            MessageExtractorContext
+	publisher            MessagePublisherContext
+	retry                *RetryPolicy
+	deadLetters          DeadLetterSink
+	concurrency          int
+	partialBatchResponse bool
+	fifo                 bool
+	groupID              MessageGroupIDFunc
+	deduplicationID      DeduplicationIDFunc
+	blobs                BlobStore
+	claimCheckThreshold  int
+	topicArns            *cache
+	cacheOptions         CacheOptions
+	unknownTopicPolicy   UnknownTopicPolicy
+	fallbackTopic        string
+	guard                *TopicGuard
+	topicLookups         int64
+	filter               RecordFilter
+	filtered             int64
+	transforms           []topicTransform
+	cloudEvents          *CloudEventsOptions
+	metricsSink          MetricsSink
+	metricsNamespace     string
+	metrics              metrics
+	timeout              time.Duration
+	safetyMargin         time.Duration
+	now                  func() time.Time
+	writer               zap.WriteSyncer
+	log                  zap.Logger
+}
+
+func (h *Handler) HandlerFunc(event json.RawMessage, lambda *apex.Context) (interface{}, error) {
 	defer h.writer.Sync()
 
+	deadline := h.deadline(h.now())
+
+	ctx, cancel := h.newContext(lambda)
+	defer cancel()
+
+	atomic.StoreInt64(&h.topicLookups, 0)
+	atomic.StoreInt64(&h.filtered, 0)
+
+	stats := h.topicArns.Stats()
+	defer func() {
+		current := h.topicArns.Stats()
+		h.putMetric(MetricCacheHits, UnitCount, float64(current.Hits-stats.Hits), nil)
+		h.putMetric(MetricCacheMisses, UnitCount, float64(current.Misses-stats.Misses), nil)
+		h.flushMetrics()
+
+		h.log.Info("zephyr:finished",
+			zap.Int64("cache_hits", current.Hits-stats.Hits),
+			zap.Int64("cache_misses", current.Misses-stats.Misses),
+			zap.Int64("filtered", atomic.LoadInt64(&h.filtered)),
+		)
+	}()
+
 	var records Records
 	err := json.Unmarshal(event, &records)
 	if err != nil {
@@ -78,74 +143,321 @@ func (h *Handler) HandlerFunc(event json.RawMessage, ctx *apex.Context) (interfa
 	}
 
 	h.log.Info("zephyr:records", zap.Int("records", len(records.Records)))
-	for _, record := range records.Records {
-		logger := h.log
+	h.putMetric(MetricBatchSize, UnitCount, float64(len(records.Records)), nil)
 
-		// ---- Identify Env ----------------------------------------------------
-		env, ok := h.identifier.IdentifyEnv(record)
-		if ok {
-			logger = logger.With(zap.String("env", env))
+	response := &BatchResponse{
+		BatchItemFailures: []BatchItemFailure{},
+	}
+	errs := h.handleRecords(ctx, records.Records, deadline)
+	h.logProgress(records.Records, errs)
+
+	var failed error
+	for i, err := range errs {
+		if err != nil {
+			if failed == nil {
+				failed = err
+			}
+
+			record := records.Records[i]
+			env, _ := h.identifier.IdentifyEnv(record)
+			h.putMetric(MetricRecordsFailed, UnitCount, 1, dimensions(record, env, ""))
+
+			response.BatchItemFailures = append(response.BatchItemFailures, BatchItemFailure{
+				ItemIdentifier: records.Records[i].Dynamodb.SequenceNumber,
+			})
 		}
+	}
 
-		// ---- Determine Topic Name --------------------------------------------
+	if n := len(response.BatchItemFailures); n > 0 {
+		h.log.Warn("zephyr:err:batch_item_failures", zap.Int("failures", n))
+	}
 
-		topicName, err := h.namer.TopicName(record)
-		if err != nil {
-			logger.Info("zephyr:err:topic_name", zap.Err(err))
+	if !h.partialBatchResponse {
+		return nil, failed
+	}
+	return response, nil
+}
+
+func (h *Handler) handleRecord(ctx context.Context, record Record) error {
+	logger := h.log.With(zap.String("seq", record.Dynamodb.SequenceNumber))
+
+	// ---- Identify Env ----------------------------------------------------
+	env, ok := h.identifier.IdentifyEnv(record)
+	if ok {
+		logger = logger.With(zap.String("env", env))
+	}
+	h.putMetric(MetricRecordsReceived, UnitCount, 1, dimensions(record, env, ""))
+
+	// ---- Filter Record ---------------------------------------------------
+
+	if h.filter != nil && !h.filter.FilterRecord(record) {
+		atomic.AddInt64(&h.filtered, 1)
+		h.putMetric(MetricRecordsFiltered, UnitCount, 1, dimensions(record, env, ""))
+		return nil
+	}
+
+	// ---- Determine Topic Name --------------------------------------------
+
+	var failed error
+
+	topicNames, errs := h.topicNames(ctx, record)
+	for _, err := range errs {
+		logger.Info("zephyr:err:topic_name", zap.Err(err))
+		if h.deadLetters != nil {
+			if err := h.deadLetter(logger, record, StageTopicName, err); err != nil && failed == nil {
+				failed = err
+			}
 		}
-		if topicName == "" {
-			continue
+	}
+	topicNames = h.allowedTopics(logger, topicNames)
+	if len(topicNames) == 0 {
+		return failed
+	}
+
+	// ---- Extract Message -------------------------------------------------
+
+	messages, stage, err := h.extractMessages(ctx, record, env, topicNames)
+	if err != nil {
+		logger.Warn("zephyr:err:"+stage, zap.Err(err))
+		if h.deadLetters != nil {
+			return h.deadLetter(logger, record, stage, err)
 		}
+		return err
+	}
 
-		// ---- Publish Record --------------------------------------------------
+	// ---- Publish Record --------------------------------------------------
 
-		err = h.Publish(logger, topicName, record)
+	for i, topicName := range topicNames {
+		since := time.Now()
+		message := messages[i]
+		err = h.publish(ctx, logger, topicName, message)
 
 		if err != nil && ErrCode(err) == "NotFound" {
-			logger.Warn("zephyr:err:topic_not_found")
+			logger.Warn("zephyr:err:topic_not_found", zap.String("name", topicName))
 			h.topicArns.Delete(topicName)
-			err = h.Publish(logger, topicName, record)
+			err = h.publish(ctx, logger, topicName, message)
+		}
+
+		if err != nil && isTopicNotFound(err) {
+			err = h.unknownTopic(ctx, logger, record, topicName, message, err)
 		}
 
+		topicDimensions := dimensions(record, env, topicName)
+		h.putMetric(MetricPublishLatency, UnitMilliseconds, float64(time.Since(since))/float64(time.Millisecond), topicDimensions)
 		if err != nil {
-			return nil, err
+			h.putMetric(MetricMessagesFailed, UnitCount, 1, topicDimensions)
+		} else {
+			h.putMetric(MetricMessagesPublished, UnitCount, 1, topicDimensions)
+		}
+
+		if err != nil && failed == nil {
+			failed = err
 		}
 	}
 
-	return nil, nil
+	return failed
 }
 
-func (h *Handler) Publish(logger zap.Logger, topicName string, record Record) error {
-	since := time.Now()
+// unknownTopic applies the UnknownTopicPolicy to a record whose topic does not exist
+func (h *Handler) unknownTopic(ctx context.Context, logger zap.Logger, record Record, topicName string, message Message, err error) error {
+	switch h.unknownTopicPolicy {
+	case UnknownTopicDeadLetter:
+		if h.deadLetters == nil {
+			return err
+		}
+		return h.deadLetter(logger, record, StageTopicNotFound, fmt.Errorf("%v: %v", topicName, err))
 
-	log := logger.With(zap.String("name", topicName))
+	case UnknownTopicFallback:
+		fallback := h.fallbackTopic
+		if h.fifo {
+			fallback = fifoTopicName(fallback)
+		}
+		logger.Info("zephyr:topic_fallback", zap.String("name", topicName), zap.String("fallback", fallback))
+		return h.publish(ctx, logger, fallback, message)
 
-	// ---- Lookup Topic ARN ------------------------------------------------
+	default:
+		return err
+	}
+}
+
+// topicNames returns the distinct, non-empty destinations for record from both the
+// TopicNamer and the MultiTopicNamer, along with the error of each namer that failed.
+// The namers are independent; one failing doesn't keep the record from the other's topics.
+func (h *Handler) topicNames(ctx context.Context, record Record) ([]string, []error) {
+	var topicNames []string
+	var errs []error
+
+	topicName, err := h.namer.TopicNameContext(ctx, record)
+	if err != nil {
+		errs = append(errs, err)
+	} else if topicName != "" {
+		topicNames = append(topicNames, topicName)
+	}
 
-	topicArn, ok := h.topicArns.Get(topicName)
-	if !ok {
-		arn, err := h.finder.FindTopicArn(topicName)
+	if h.multiNamer != nil {
+		names, err := h.multiNamer.TopicNames(record)
 		if err != nil {
-			log.Warn("zephyr:err:topic_arn", zap.Err(err))
-			return err
+			errs = append(errs, err)
+			names = nil
+		}
+
+	loop:
+		for _, name := range names {
+			if name == "" {
+				continue
+			}
+			for _, existing := range topicNames {
+				if name == existing {
+					continue loop
+				}
+			}
+			topicNames = append(topicNames, name)
 		}
-		topicArn = arn
-		h.topicArns.Set(topicName, topicArn)
-		log.Info("zephyr:topic_arn", zap.Duration("elapsed", time.Now().Sub(since)/time.Millisecond))
 	}
-	log = log.With(zap.String("arn", *topicArn))
 
-	// ---- Extract Message -------------------------------------------------
+	if h.fifo {
+		for i, name := range topicNames {
+			topicNames[i] = fifoTopicName(name)
+		}
+	}
+
+	return topicNames, errs
+}
+
+func (h *Handler) deadLetter(logger zap.Logger, record Record, stage string, err error) error {
+	err = h.deadLetters.DeadLetter(record, stage, err)
+	if err != nil {
+		logger.Warn("zephyr:err:dead_letter", zap.String("stage", stage), zap.Err(err))
+		return err
+	}
+
+	logger.Info("zephyr:dead_letter", zap.String("stage", stage))
+	return nil
+}
+
+// extractMessages returns the Message to publish to each of topicNames along with the
+// stage that failed, if any.  The body is extracted once and shared unless the
+// MessageExtractor is also a TopicMessageExtractor.
+func (h *Handler) extractMessages(ctx context.Context, record Record, env string, topicNames []string) ([]Message, string, error) {
+	attributes, err := h.messageAttributes(record, env)
+	if err != nil {
+		return nil, StageMessageAttributes, err
+	}
+
+	template := Message{
+		Attributes: attributes,
+	}
+
+	if h.fifo {
+		if err := h.fifoIDs(record, &template); err != nil {
+			return nil, StageExtractMessage, err
+		}
+	}
+
+	topicExtractor, ok := h.topicMessageExtractor()
+	encoder, encoded := h.messageEncoder()
+	perTopic := ok || len(h.transforms) > 0 || h.cloudEvents != nil
+
+	messages := make([]Message, len(topicNames))
+	for i, topicName := range topicNames {
+		if i > 0 && !perTopic {
+			messages[i] = messages[0]
+			continue
+		}
+
+		var body string
+		var suffix string
+		var contentType string
+		if perTopic {
+			suffix = topicName
+		}
+
+		transformed := h.transformRecord(topicName, record)
+		if topicExtractor != nil {
+			body, err = topicExtractor.ExtractTopicMessage(topicName, transformed)
+		} else {
+			body, err = h.extractor.ExtractMessageContext(ctx, transformed)
+		}
+		if err != nil {
+			return nil, StageExtractMessage, err
+		}
+		if encoded {
+			contentType = encoder.ContentType()
+		}
+
+		// offload the data before wrapping it so an oversized message is still published
+		// as a CloudEvent, with the claim check as its data
+		if h.blobs != nil && len(body) > h.claimCheckThreshold {
+			body, err = h.claimCheck(record, suffix, body, contentType)
+			if err != nil {
+				return nil, StageClaimCheck, err
+			}
+			contentType = ""
+		}
+
+		if h.cloudEvents != nil {
+			body, err = newCloudEvent(topicName, transformed, body, contentType, *h.cloudEvents)
+			if err != nil {
+				return nil, StageExtractMessage, err
+			}
+		}
+
+		messages[i] = template
+		messages[i].Body = body
+		if contentType != "" && h.cloudEvents == nil {
+			messages[i].Attributes = withContentType(template.Attributes, contentType)
+		}
+	}
+
+	return messages, "", nil
+}
+
+func (h *Handler) Publish(logger zap.Logger, topicName string, record Record) error {
+	return h.PublishContext(context.Background(), logger, topicName, record)
+}
+
+func (h *Handler) PublishContext(ctx context.Context, logger zap.Logger, topicName string, record Record) error {
+	env, _ := h.identifier.IdentifyEnv(record)
+
+	if h.fifo {
+		topicName = fifoTopicName(topicName)
+	}
+
+	if len(h.allowedTopics(logger, []string{topicName})) == 0 {
+		return ErrTopicDenied
+	}
+
+	messages, stage, err := h.extractMessages(ctx, record, env, []string{topicName})
+	if err != nil {
+		logger.Warn("zephyr:err:"+stage, zap.String("name", topicName), zap.Err(err))
+		return err
+	}
+
+	return h.publish(ctx, logger, topicName, messages[0])
+}
+
+func (h *Handler) publish(ctx context.Context, logger zap.Logger, topicName string, message Message) error {
+	since := time.Now()
+
+	log := logger.With(zap.String("name", topicName))
+
+	// ---- Lookup Topic ARN ------------------------------------------------
 
-	r, err := h.extractor.ExtractMessage(record)
+	topicArn, loaded, err := h.topicArns.GetOrLoad(ctx, topicName, func(topicName string) (*string, error) {
+		return h.finder.FindTopicArnContext(ctx, topicName)
+	})
 	if err != nil {
-		log.Warn("zephyr:err:extract_message", zap.Err(err))
+		log.Warn("zephyr:err:topic_arn", zap.Err(err))
 		return err
 	}
+	if loaded {
+		log.Info("zephyr:topic_arn", zap.Duration("elapsed", time.Now().Sub(since)/time.Millisecond))
+	}
+	log = log.With(zap.String("arn", *topicArn))
 
 	// ---- Publish Message -------------------------------------------------
 
-	err = h.publisher.Publish(log, topicArn, r)
+	err = h.publisher.PublishMessageContext(ctx, log, topicArn, message)
 	if err != nil {
 		log.Warn("zephyr:err:publish", zap.Err(err))
 		return err
@@ -156,44 +468,75 @@ func (h *Handler) Publish(logger zap.Logger, topicName string, record Record) er
 }
 
 func New(opts ...Option) apex.HandlerFunc {
-	region := os.Getenv("AWS_REGION")
-	if region == "" {
-		region = "us-east-1"
-	}
-
-	cfg := &aws.Config{Region: aws.String(region)}
-	client := sns.New(session.New(cfg))
+	client := sns.New(session.New(awsConfig()))
 
 	handler := &Handler{
-		identifier: EnvIdentifierFunc(identifyEnv),
-		namer:      TopicNameFunc(topicName),
-		finder:     newLookupTopicArn(client),
-		extractor:  ExtractMessageFunc(jsonMessage),
-		publisher:  newPublishFunc(client),
-		writer:     zap.AddSync(ioutil.Discard),
+		identifier:      EnvIdentifierFunc(identifyEnv),
+		namer:           TopicNameFunc(topicName),
+		finder:          newLookupTopicArn(client),
+		extractor:       ExtractMessageFunc(jsonMessage),
+		publisher:       asMessagePublisherContext(newPublisher(client)),
+		groupID:         KeysGroupID,
+		deduplicationID: EventDeduplicationID,
+		writer:          zap.AddSync(ioutil.Discard),
+		now:             time.Now,
 	}
 
 	for _, opt := range opts {
 		opt(handler)
 	}
 
-	handler.topicArns = newCache()
+	handler.topicArns = newCache(handler.cacheOptions)
 
 	// setup logging
+	handler.writer = newLockedWriteSyncer(handler.writer)
+	if handler.metricsNamespace != "" && handler.metricsSink == nil {
+		handler.metricsSink = NewEMFSink(handler.metricsNamespace, handler.writer)
+	}
 	id := strconv.FormatInt(time.Now().Unix(), 36)
 	handler.log = zap.NewJSON(
-		zap.Output(zap.AddSync(handler.writer)),
+		zap.Output(handler.writer),
 		zap.Append(appendTimestamp),
 	).With(
 		zap.String("id", id),
 		zap.String("service", "zephyr"),
 	)
 
+	if handler.retry != nil {
+		handler.publisher = &retryPublisher{
+			policy: *handler.retry,
+			target: handler.publisher,
+		}
+		handler.finder = &retryTopicArnFinder{
+			policy: *handler.retry,
+			target: handler.finder,
+			log:    handler.log,
+		}
+	}
+
+	if handler.guard != nil && handler.guard.MaxTopicLookups > 0 {
+		handler.finder = &guardedTopicArnFinder{
+			max:    int64(handler.guard.MaxTopicLookups),
+			count:  &handler.topicLookups,
+			target: handler.finder,
+			log:    handler.log,
+		}
+	}
+
 	handler.log.Info("zephyr:started")
 
 	return handler.HandlerFunc
 }
 
+func awsConfig() *aws.Config {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &aws.Config{Region: aws.String(region)}
+}
+
 func appendTimestamp(data []byte, t time.Time) []byte {
 	data = append(data, `,"timestamp":"`...)
 	data = t.UTC().AppendFormat(data, "2006-01-02T15:04:05.000Z")
@@ -208,6 +551,16 @@ func jsonMessage(r Record) (string, error) {
 	return string(data), nil
 }
 
+// OldImageMessage publishes the item as it existed before the change; useful for
+// REMOVE events where the NewImage is empty
+func OldImageMessage(r Record) (string, error) {
+	data, err := json.Marshal(r.Dynamodb.OldImage)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 func identifyEnv(r Record) (string, bool) {
 	return "", false
 }
@@ -218,6 +571,10 @@ func topicName(r Record) (string, error) {
 
 func newLookupTopicArn(client *sns.SNS) FindTopicArnFunc {
 	return func(topicName string) (*string, error) {
+		if strings.HasSuffix(topicName, FIFOSuffix) {
+			return createFIFOTopic(client, topicName)
+		}
+
 		out, err := client.CreateTopic(&sns.CreateTopicInput{
 			Name: aws.String(topicName),
 		})
@@ -229,13 +586,29 @@ func newLookupTopicArn(client *sns.SNS) FindTopicArnFunc {
 	}
 }
 
-func newPublishFunc(client *sns.SNS) PublishFunc {
-	return func(logger zap.Logger, topicArn *string, message string) error {
-		_, err := client.Publish(&sns.PublishInput{
-			TopicArn: topicArn,
-			Message:  aws.String(message),
-		})
+type snsPublisher struct {
+	client *sns.SNS
+}
 
-		return err
+func (p *snsPublisher) PublishMessage(logger zap.Logger, topicArn *string, message Message) error {
+	if message.GroupID != "" {
+		return publishFIFO(p.client, topicArn, message)
+	}
+
+	input := &sns.PublishInput{
+		TopicArn: topicArn,
+		Message:  aws.String(message.Body),
+	}
+	if len(message.Attributes) > 0 {
+		input.MessageAttributes = message.Attributes
+	}
+
+	_, err := p.client.Publish(input)
+	return err
+}
+
+func newPublisher(client *sns.SNS) *snsPublisher {
+	return &snsPublisher{
+		client: client,
 	}
 }
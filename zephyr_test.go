@@ -2,11 +2,17 @@ package zephyr_test
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/savaki/zap"
 	"github.com/savaki/zephyr"
 )
@@ -58,3 +64,434 @@ func TestCompiles(t *testing.T) {
 		t.Errorf("expected lookupTopicArnCount == 1; got %v", lookupTopicArnCount)
 	}
 }
+
+func TestPartialBatchFailure(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "dynamodb": { "Keys": { "id": { "S": "1" } }, "SequenceNumber": "100" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "2" } }, "SequenceNumber": "200" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "3" } }, "SequenceNumber": "300" } }
+	]
+}`
+
+	var publishCount int32
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithPartialBatchResponse(),
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return record.Dynamodb.SequenceNumber, nil
+		}),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			atomic.AddInt32(&publishCount, 1)
+			if *topicArn == "200" {
+				return errors.New("boom")
+			}
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	v, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if publishCount != 3 {
+		t.Errorf("expected publishCount == 3; got %v", publishCount)
+	}
+
+	response, ok := v.(*zephyr.BatchResponse)
+	if !ok {
+		t.Fatalf("expected *zephyr.BatchResponse; got %T", v)
+	}
+	if len(response.BatchItemFailures) != 1 {
+		t.Fatalf("expected 1 failure; got %v", len(response.BatchItemFailures))
+	}
+	if id := response.BatchItemFailures[0].ItemIdentifier; id != "200" {
+		t.Errorf("expected 200; got %v", id)
+	}
+}
+
+func TestBatchFailureWithoutPartialResponse(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "dynamodb": { "Keys": { "id": { "S": "1" } }, "SequenceNumber": "100" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "2" } }, "SequenceNumber": "200" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "3" } }, "SequenceNumber": "300" } }
+	]
+}`
+
+	boom := errors.New("boom")
+	var published []string
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return record.Dynamodb.SequenceNumber, nil
+		}),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			if *topicArn == "200" {
+				return boom
+			}
+			published = append(published, *topicArn)
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	v, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != boom {
+		t.Errorf("expected %v; got %v", boom, err)
+	}
+	if v != nil {
+		t.Errorf("expected nil response; got %v", v)
+	}
+	if expected := "100"; strings.Join(published, ",") != expected {
+		t.Errorf("expected publishing to stop at the first failure; got %v", published)
+	}
+}
+
+func TestSequentialPrecedingRecordFailed(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "dynamodb": { "Keys": { "id": { "S": "1" } }, "SequenceNumber": "100" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "2" } }, "SequenceNumber": "200" } },
+		{ "dynamodb": { "Keys": { "id": { "S": "1" } }, "SequenceNumber": "300" } }
+	]
+}`
+
+	var published []string
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithPartialBatchResponse(),
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return record.Dynamodb.SequenceNumber, nil
+		}),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			if *topicArn == "100" {
+				return errors.New("boom")
+			}
+			published = append(published, *topicArn)
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	v, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("expected nil error; got %v", err)
+	}
+	if expected := "200"; strings.Join(published, ",") != expected {
+		t.Errorf("expected only the unrelated record to be published; got %v", published)
+	}
+
+	var failed []string
+	for _, failure := range v.(*zephyr.BatchResponse).BatchItemFailures {
+		failed = append(failed, failure.ItemIdentifier)
+	}
+	if expected := "100,300"; strings.Join(failed, ",") != expected {
+		t.Errorf("expected %v to fail; got %v", expected, failed)
+	}
+}
+
+func TestConcurrencyPreservesKeyOrder(t *testing.T) {
+	records := zephyr.Records{}
+	for i := 0; i < 40; i++ {
+		id := strconv.Itoa(i % 4)
+		records.Records = append(records.Records, zephyr.Record{
+			Dynamodb: zephyr.StreamRecord{
+				Keys:           map[string]zephyr.AttributeValue{"id": {S: aws.String(id)}},
+				SequenceNumber: strconv.Itoa(1000 + i),
+			},
+		})
+	}
+	message, _ := json.Marshal(records)
+
+	mux := &sync.Mutex{}
+	published := map[string][]string{}
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return *record.Dynamodb.Keys["id"].S, nil
+		}),
+		zephyr.WithMessageExtractor(zephyr.ExtractMessageFunc(func(record zephyr.Record) (string, error) {
+			return record.Dynamodb.SequenceNumber, nil
+		})),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			mux.Lock()
+			defer mux.Unlock()
+			published[*topicArn] = append(published[*topicArn], message)
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+		zephyr.WithConcurrency(4),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if len(published) != 4 {
+		t.Errorf("expected 4 keys; got %v", len(published))
+	}
+	for id, seqs := range published {
+		if len(seqs) != 10 {
+			t.Errorf("%v: expected 10 messages; got %v", id, len(seqs))
+		}
+		if !sort.StringsAreSorted(seqs) {
+			t.Errorf("%v: expected messages in sequence order; got %v", id, seqs)
+		}
+	}
+}
+
+func TestMultiTopicNamer(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "dynamodb": { "SequenceNumber": "100" } }
+	]
+}`
+
+	published := map[string]int{}
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithPartialBatchResponse(),
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return "orders-open", nil
+		}),
+		zephyr.WithTopicNamesFunc(func(record zephyr.Record) ([]string, error) {
+			return []string{"orders-audit", "orders-open", "broken"}, nil
+		}),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			published[*topicArn]++
+			if *topicArn == "broken" {
+				return errors.New("boom")
+			}
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	v, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	for _, topicName := range []string{"orders-open", "orders-audit", "broken"} {
+		if published[topicName] != 1 {
+			t.Errorf("expected 1 message to %v; got %v", topicName, published[topicName])
+		}
+	}
+	if failures := v.(*zephyr.BatchResponse).BatchItemFailures; len(failures) != 1 {
+		t.Errorf("expected 1 failure; got %v", failures)
+	}
+}
+
+func TestMultiTopicNamerIndependentOfTopicNamer(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "eventID": "abc", "dynamodb": { "SequenceNumber": "100" } }
+	]
+}`
+
+	var published []string
+	var deadLetters []string
+
+	// Given - the per-state namer can't name the record, the audit namer can
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return "", errors.New("state not found")
+		}),
+		zephyr.WithTopicNamesFunc(func(record zephyr.Record) ([]string, error) {
+			return []string{"orders-audit"}, nil
+		}),
+		zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+			published = append(published, *topicArn)
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+		zephyr.WithDeadLetterFunc(func(record zephyr.Record, stage string, err error) error {
+			deadLetters = append(deadLetters, stage+":"+err.Error())
+			return nil
+		}),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+	if expected := "orders-audit"; strings.Join(published, ",") != expected {
+		t.Errorf("expected %v; got %v", expected, published)
+	}
+	if expected := zephyr.StageTopicName + ":state not found"; strings.Join(deadLetters, ",") != expected {
+		t.Errorf("expected %v; got %v", expected, deadLetters)
+	}
+}
+
+func TestMessageAttributes(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{
+			"eventID": "abc",
+			"eventName": "INSERT",
+			"eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/2016-05-16T22:22:50.550",
+			"dynamodb": { "SequenceNumber": "100" }
+		}
+	]
+}`
+
+	var attributes map[string]*sns.MessageAttributeValue
+
+	// Given
+	handler := zephyr.New(
+		zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+			return "blah", nil
+		}),
+		zephyr.WithEnvIdentifier(zephyr.EnvIdentifierFunc(func(record zephyr.Record) (string, bool) {
+			return "dev", true
+		})),
+		zephyr.WithMessageAttributesFunc(func(record zephyr.Record) (map[string]*sns.MessageAttributeValue, error) {
+			return map[string]*sns.MessageAttributeValue{
+				"custom": zephyr.StringAttribute("value"),
+			}, nil
+		}),
+		zephyr.WithPublishMessageFunc(func(logger zap.Logger, topicArn *string, message zephyr.Message) error {
+			attributes = message.Attributes
+			return nil
+		}),
+		zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+			return aws.String(topicName), nil
+		}),
+	)
+
+	// When
+	_, err := handler.Handle(json.RawMessage(message), nil)
+
+	// Then
+	if err != nil {
+		t.Errorf("expected nil error; got %v", err)
+	}
+
+	expected := map[string]string{
+		zephyr.AttributeEventName: "INSERT",
+		zephyr.AttributeEventID:   "abc",
+		zephyr.AttributeTableName: "orders",
+		zephyr.AttributeEnv:       "dev",
+		"custom":                  "value",
+	}
+	if len(attributes) != len(expected) {
+		t.Errorf("expected %v attributes; got %v", len(expected), len(attributes))
+	}
+	for k, v := range expected {
+		if attr, ok := attributes[k]; !ok || *attr.StringValue != v {
+			t.Errorf("expected %v=%v; got %v", k, v, attr)
+		}
+	}
+}
+
+func TestUnknownTopicPolicy(t *testing.T) {
+	message := `
+{
+	"Records": [
+		{ "dynamodb": { "SequenceNumber": "100" } }
+	]
+}`
+
+	testCases := map[string]struct {
+		Option    zephyr.Option
+		Published []string
+		Failures  int
+		Dead      int
+	}{
+		"error": {
+			Option:   zephyr.WithUnknownTopicPolicy(zephyr.UnknownTopicError),
+			Failures: 1,
+		},
+		"dead-letter": {
+			Option: zephyr.WithUnknownTopicPolicy(zephyr.UnknownTopicDeadLetter),
+			Dead:   1,
+		},
+		"fallback": {
+			Option:    zephyr.WithFallbackTopic("unrouted"),
+			Published: []string{"unrouted"},
+		},
+	}
+
+	for label, tc := range testCases {
+		var published []string
+		var dead int
+
+		handler := zephyr.New(
+			zephyr.WithPartialBatchResponse(),
+			zephyr.WithTopicNameFunc(func(record zephyr.Record) (string, error) {
+				return "unknown", nil
+			}),
+			zephyr.WithPublishFunc(func(logger zap.Logger, topicArn *string, message string) error {
+				published = append(published, *topicArn)
+				return nil
+			}),
+			zephyr.WithFindTopicArnFunc(func(topicName string) (*string, error) {
+				if topicName == "unknown" {
+					return nil, zephyr.ErrTopicNotFound
+				}
+				return aws.String(topicName), nil
+			}),
+			zephyr.WithDeadLetterFunc(func(record zephyr.Record, stage string, err error) error {
+				dead++
+				return nil
+			}),
+			tc.Option,
+		)
+
+		v, err := handler.Handle(json.RawMessage(message), nil)
+		if err != nil {
+			t.Errorf("%v: expected nil error; got %v", label, err)
+		}
+		if failures := v.(*zephyr.BatchResponse).BatchItemFailures; len(failures) != tc.Failures {
+			t.Errorf("%v: expected %v failures; got %v", label, tc.Failures, len(failures))
+		}
+		if len(published) != len(tc.Published) || (len(published) > 0 && published[0] != tc.Published[0]) {
+			t.Errorf("%v: expected %v; got %v", label, tc.Published, published)
+		}
+		if dead != tc.Dead {
+			t.Errorf("%v: expected %v dead letters; got %v", label, tc.Dead, dead)
+		}
+	}
+}